@@ -0,0 +1,135 @@
+package urlf
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ArrayStyle is the encoding of slices in query values. Set it by Opt.ArrayStyle for a formatter
+// or by a marker of the placeholder like ids={,}.
+type ArrayStyle int
+
+const (
+	ArrayRepeat   ArrayStyle = iota + 1 // id=1&id=2 (default) {*}
+	ArrayComma                          // id=1,2 {,}
+	ArraySpace                          // id=1+2 { }
+	ArrayPipe                           // id=1|2 {|}
+	ArrayBrackets                       // id[]=1&id[]=2 {[]}
+	ArrayIndexed                        // id[0]=1&id[1]=2 {[0]}
+)
+
+var arrayMarkers = []struct {
+	marker string
+	style  ArrayStyle
+}{
+	{"*", ArrayRepeat},
+	{",", ArrayComma},
+	{" ", ArraySpace},
+	{"|", ArrayPipe},
+	{"[]", ArrayBrackets},
+	{"[0]", ArrayIndexed},
+}
+
+// cutArrayStyle removes the array style marker at the beginning of the placeholder body.
+func cutArrayStyle(body string) (ArrayStyle, string) {
+	for _, m := range arrayMarkers {
+		if rest, ok := strings.CutPrefix(body, m.marker); ok {
+			return m.style, rest
+		}
+	}
+	return 0, body
+}
+
+// arrayMarker returns the marker of the style for error messages.
+func arrayMarker(style ArrayStyle) string {
+	for _, m := range arrayMarkers {
+		if m.style == style {
+			return m.marker
+		}
+	}
+	return ""
+}
+
+// updateQueryArray adds the slice value in the array style other than ArrayRepeat.
+// It returns false if the value is not a slice.
+func (st *formatState) updateQueryArray(k0, k1 int, p part[string], style ArrayStyle, value any) (bool, error) {
+	var elements reflect.Value
+	if e, ok := st.encoder(value); ok {
+		if e.multi == nil {
+			return false, nil
+		}
+		values, err := e.values(value)
+		if err != nil {
+			return true, newFormatError(p.index, "query", value, "%v", err)
+		}
+		elements = reflect.ValueOf(values)
+	} else if elements = reflect.ValueOf(value); elements.Kind() != reflect.Slice || hasText(value) {
+		return false, nil
+	}
+	switch style {
+	case ArrayBrackets:
+		k0, k1 = st.appendArrayKey(k0, k1, -1)
+		for i := 0; i < elements.Len(); i++ {
+			if err := st.updateQueryElement(k0, k1, p, i, elements.Index(i).Interface()); err != nil {
+				return true, elementError(err, i)
+			}
+		}
+	case ArrayIndexed:
+		for i := 0; i < elements.Len(); i++ {
+			ek0, ek1 := st.appendArrayKey(k0, k1, i)
+			if err := st.updateQueryElement(ek0, ek1, p, 0, elements.Index(i).Interface()); err != nil {
+				return true, elementError(err, i)
+			}
+		}
+	default:
+		// elements are escaped one by one to keep delimiters in them distinguishable
+		delimiter := byte(',')
+		switch style {
+		case ArraySpace:
+			delimiter = '+'
+		case ArrayPipe:
+			delimiter = '|'
+		}
+		v0, n := len(st.scratch), 0 // n is the number of non-nil elements
+		for i := 0; i < elements.Len(); i++ {
+			start := len(st.scratch)
+			if n > 0 {
+				st.scratch = append(st.scratch, delimiter)
+			}
+			e0 := len(st.scratch)
+			ev := elements.Index(i).Interface()
+			var ok bool
+			var err error
+			st.scratch, ok, err = st.appendValue(st.scratch, ev, p.spec)
+			if err != nil {
+				return true, elementError(newFormatError(p.index, "query", ev, "%v", err), i)
+			}
+			if !ok { // nil elements are skipped
+				st.scratch = st.scratch[:start]
+				continue
+			}
+			e1 := len(st.scratch)
+			st.scratch = appendEscape(st.scratch, st.scratch[e0:e1], encodeQueryComponent)
+			st.scratch = st.scratch[:e0+copy(st.scratch[e0:], st.scratch[e1:])]
+			n++
+		}
+		if n > 0 {
+			st.deleteQuery(k0, k1)
+			st.pairs = append(st.pairs, queryPair{k0: k0, k1: k1, v0: v0, v1: len(st.scratch), escaped: true})
+		}
+	}
+	return true, nil
+}
+
+// appendArrayKey stores the key with brackets like "id[]" (i < 0) or "id[1]" in scratch and returns its position.
+func (st *formatState) appendArrayKey(k0, k1, i int) (int, int) {
+	start := len(st.scratch)
+	st.scratch = append(st.scratch, st.scratch[k0:k1]...)
+	st.scratch = append(st.scratch, '[')
+	if i >= 0 {
+		st.scratch = strconv.AppendInt(st.scratch, int64(i), 10)
+	}
+	st.scratch = append(st.scratch, ']')
+	return start, len(st.scratch)
+}
@@ -0,0 +1,53 @@
+package urlf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestArrayStyle(t *testing.T) {
+	tests := []formatCase{
+		{name: "repeat", format: "https://example.com/?id={}", args: []any{[]int{1, 2}}, want: "https://example.com/?id=1&id=2"},
+		{name: "comma", format: "https://example.com/?id={,}", args: []any{[]int{1, 2}}, want: "https://example.com/?id=1,2"},
+		{name: "space", format: "https://example.com/?id={ }", args: []any{[]string{"a", "b"}}, want: "https://example.com/?id=a+b"},
+		{name: "comma in elements", format: "https://example.com/?id={,}", args: []any{[]string{"a,b", "c"}}, want: "https://example.com/?id=a%2Cb,c"},
+		{name: "space in elements", format: "https://example.com/?id={ }", args: []any{[]string{"a b", "c+d"}}, want: "https://example.com/?id=a+b+c%2Bd"},
+		{name: "pipe in elements", format: "https://example.com/?id={|}", args: []any{[]string{"a|b", "c"}}, want: "https://example.com/?id=a%7Cb|c"},
+		{name: "pipe", format: "https://example.com/?id={|}", args: []any{[]any{"a", 2}}, want: "https://example.com/?id=a|2"},
+		{name: "brackets", format: "https://example.com/?id={[]}", args: []any{[]int{1, 2}}, want: "https://example.com/?id%5B%5D=1&id%5B%5D=2"},
+		{name: "indexed", format: "https://example.com/?id={[0]}", args: []any{[]string{"a", "b"}}, want: "https://example.com/?id%5B0%5D=a&id%5B1%5D=b"},
+		{name: "scalar", format: "https://example.com/?id={[]}&tag={,}", args: []any{1, "go"}, want: "https://example.com/?id=1&tag=go"},
+		{name: "nil elements", format: "https://example.com/?id={,}", args: []any{[]any{nil, 1, nil, 2}}, want: "https://example.com/?id=1,2"},
+		{name: "empty", format: "https://example.com/?id={,}", args: []any{[]int{}}, want: "https://example.com/"},
+		{name: "with spec", format: "https://example.com/?id={,:03d}", args: []any{[]int{1, 2}}, want: "https://example.com/?id=001,002"},
+		{name: "with marker", format: "https://example.com/?id={,!}", args: []any{[]int{1}}, want: "https://example.com/?id=1"},
+		{name: "option", opt: Opt{ArrayStyle: ArrayComma}, format: "https://example.com/?id={}", args: []any{[]int{1, 2}}, want: "https://example.com/?id=1,2"},
+		{name: "omit default", opt: Opt{OmitDefaultQuery: true}, format: "https://example.com/?id={ =a b}", args: []any{[]string{"a", "b"}}, want: "https://example.com/"},
+		{name: "placeholder over option", opt: Opt{ArrayStyle: ArrayComma}, format: "https://example.com/?id={*}", args: []any{[]int{1, 2}}, want: "https://example.com/?id=1&id=2"},
+		{name: "multi encoder", format: "https://example.com/?r={,}", args: []any{region{"asia", "japan"}}, want: "https://example.com/?r=asia,japan"},
+		{name: "overwrite", format: "https://example.com/?id=0&id={,}", args: []any{[]int{1, 2}}, want: "https://example.com/?id=1,2"},
+	}
+	testFormat(t, tests)
+}
+
+func TestArrayStyleError(t *testing.T) {
+	_, err := TryCustomFormatter(Opt{ArrayStyle: ArrayIndexed + 1})("https://example.com/")
+	assert.IsError(t, err, ErrParseFailed)
+
+	for _, format := range []string{
+		"https://example.com/{,}",
+		"https://example.com/?{,}=1",
+		"https://example.com/?{,}",
+		"https://example.com/#{[]}",
+	} {
+		_, err := TryUrlf(format, nil)
+		assert.IsError(t, err, ErrParseFailed)
+	}
+
+	_, err = TryUrlf("https://example.com/?id={,}", []any{1, struct{}{}})
+	var fe *FormatError
+	assert.True(t, errors.As(err, &fe))
+	assert.Equal(t, "element 1: unsupported type", fe.Reason)
+}
@@ -0,0 +1,149 @@
+package urlf
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultCacheSize is the number of templates that the shared cache keeps.
+const DefaultCacheSize = 1024
+
+// Cache is a LRU cache of parsed URL templates. It is safe for concurrent use.
+//
+// Formatters use the shared cache (DefaultCache) unless Opt.Cache is set.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List
+	hits    atomic.Uint64
+	misses  atomic.Uint64
+}
+
+// CacheStats is a snapshot of the cache counters.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Len    int // number of cached templates
+	Size   int // max number of cached templates
+}
+
+type cacheEntry struct {
+	format   string
+	template *parseResult
+}
+
+// NewCache creates a Cache that keeps at most size templates.
+//
+// If size is 0, the cache is disabled and templates are parsed every time.
+// If size is negative, the cache is unbounded.
+func NewCache(size int) *Cache {
+	return &Cache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+var defaultCache = NewCache(DefaultCacheSize)
+
+// DefaultCache returns the cache shared by formatters without Opt.Cache.
+func DefaultCache() *Cache {
+	return defaultCache
+}
+
+// PurgeCache removes all templates from the shared cache.
+func PurgeCache() {
+	defaultCache.Purge()
+}
+
+// Precompile parses templates and stores them in the shared cache for warm-up.
+func Precompile(formats ...string) error {
+	return defaultCache.Precompile(formats...)
+}
+
+// get returns the parsed template. It parses the format and stores it if it is not in the cache.
+func (c *Cache) get(format string) (*parseResult, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[format]; ok {
+		c.lru.MoveToFront(e)
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return e.Value.(*cacheEntry).template, nil
+	}
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	t, err := parse(format)
+	if err != nil {
+		return nil, err
+	}
+	c.store(format, t)
+	return t, nil
+}
+
+func (c *Cache) store(format string, t *parseResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size == 0 {
+		return
+	}
+	if e, ok := c.entries[format]; ok { // stored by another goroutine
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[format] = c.lru.PushFront(&cacheEntry{format: format, template: t})
+	c.evict()
+}
+
+func (c *Cache) evict() {
+	for c.size >= 0 && c.lru.Len() > c.size {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.entries, e.Value.(*cacheEntry).format)
+	}
+}
+
+// Precompile parses templates and stores them in the cache for warm-up.
+// It returns the first parse error.
+func (c *Cache) Precompile(formats ...string) error {
+	for _, format := range formats {
+		t, err := parse(format)
+		if err != nil {
+			return err
+		}
+		c.store(format, t)
+	}
+	return nil
+}
+
+// SetSize changes the max number of templates. Old templates are removed if the cache is over the size.
+func (c *Cache) SetSize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = size
+	c.evict()
+}
+
+// Purge removes all templates and resets the counters.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	c.lru.Init()
+	c.hits.Store(0)
+	c.misses.Store(0)
+}
+
+// Stats returns the cache counters.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Len:    c.lru.Len(),
+		Size:   c.size,
+	}
+}
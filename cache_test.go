@@ -0,0 +1,80 @@
+package urlf
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestCache(t *testing.T) {
+	c := NewCache(2)
+	f := TryCustomFormatter(Opt{Cache: c})
+
+	_, err := f("/a/{}", 1)
+	assert.NoError(t, err)
+	_, err = f("/a/{}", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1, Len: 1, Size: 2}, c.Stats())
+
+	// "/a/{}" is the least recently used template
+	_, _ = f("/b/{}", 1)
+	_, _ = f("/c/{}", 1)
+	_, _ = f("/a/{}", 1)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 4, Len: 2, Size: 2}, c.Stats())
+
+	c.SetSize(1)
+	assert.Equal(t, 1, c.Stats().Len)
+
+	c.Purge()
+	assert.Equal(t, CacheStats{Size: 1}, c.Stats())
+}
+
+func TestCacheDisabled(t *testing.T) {
+	c := NewCache(0)
+	f := TryCustomFormatter(Opt{Cache: c})
+	for i := 0; i < 3; i++ {
+		result, err := f("/users/{}", i)
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("/users/%d", i), result)
+	}
+	assert.Equal(t, CacheStats{Misses: 3}, c.Stats())
+}
+
+func TestCacheIsolation(t *testing.T) {
+	c1 := NewCache(10)
+	c2 := NewCache(10)
+	_, _ = TryCustomFormatter(Opt{Cache: c1})("/users/{}", 1)
+	assert.Equal(t, 1, c1.Stats().Len)
+	assert.Equal(t, 0, c2.Stats().Len)
+}
+
+func TestCachePrecompile(t *testing.T) {
+	c := NewCache(10)
+	assert.NoError(t, c.Precompile("/users/{}", "/groups/{}"))
+	_, _ = TryCustomFormatter(Opt{Cache: c})("/users/{}", 1)
+	assert.Equal(t, CacheStats{Hits: 1, Len: 2, Size: 10}, c.Stats())
+
+	assert.IsError(t, c.Precompile("/users/{}", "http://:"), ErrParseFailed)
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	c := NewCache(8)
+	f := TryCustomFormatter(Opt{Cache: c})
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := f(fmt.Sprintf("/path%d/{}", (i+j)%12), j)
+				assert.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	stats := c.Stats()
+	assert.Equal(t, uint64(1600), stats.Hits+stats.Misses)
+	assert.True(t, stats.Len <= 8)
+}
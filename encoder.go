@@ -0,0 +1,131 @@
+package urlf
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Encoder converts values of a type into placeholder texts. Create it by NewEncoder or NewMultiEncoder.
+//
+// Encoders have priority over the built-in conversions, so they can change the format of
+// types like time.Time and []byte. They are not used for strings, bools, numbers, []string and []int.
+type Encoder struct {
+	typ    reflect.Type
+	encode func(v any) (string, error)
+	multi  func(v any) ([]string, error)
+}
+
+// NewEncoder creates an Encoder of type T. T must be a concrete type, not an interface.
+func NewEncoder[T any](fn func(T) (string, error)) Encoder {
+	return Encoder{typ: reflect.TypeFor[T](), encode: func(v any) (string, error) {
+		return fn(v.(T))
+	}}
+}
+
+// NewMultiEncoder creates an Encoder of type T that returns several values.
+// They become path segments in path placeholders and repeated values in query value placeholders.
+func NewMultiEncoder[T any](fn func(T) ([]string, error)) Encoder {
+	return Encoder{typ: reflect.TypeFor[T](), multi: func(v any) ([]string, error) {
+		return fn(v.(T))
+	}}
+}
+
+// PathSegmenter is implemented by types that expand into path segments in path placeholders
+// like a category hierarchy.
+type PathSegmenter interface {
+	URLSegments() []string
+}
+
+// QueryEncoder is implemented by types that expand into query parameters in query set placeholders
+// like a search filter.
+type QueryEncoder interface {
+	URLQuery() url.Values
+}
+
+var (
+	encodersLock   sync.Mutex
+	globalEncoders atomic.Pointer[map[reflect.Type]Encoder]
+)
+
+// RegisterEncoder registers the encoder of type T for all formatters. See NewEncoder.
+func RegisterEncoder[T any](fn func(T) (string, error)) {
+	registerEncoder(NewEncoder(fn))
+}
+
+// RegisterMultiEncoder registers the multi-value encoder of type T for all formatters. See NewMultiEncoder.
+func RegisterMultiEncoder[T any](fn func(T) ([]string, error)) {
+	registerEncoder(NewMultiEncoder(fn))
+}
+
+func registerEncoder(e Encoder) {
+	encodersLock.Lock()
+	defer encodersLock.Unlock()
+	encoders := map[reflect.Type]Encoder{e.typ: e}
+	if old := globalEncoders.Load(); old != nil {
+		for t, oe := range *old {
+			if t != e.typ {
+				encoders[t] = oe
+			}
+		}
+	}
+	globalEncoders.Store(&encoders)
+}
+
+// encoder returns the encoder for the value. The formatter's encoders have priority over the global ones.
+func (st *formatState) encoder(v any) (Encoder, bool) {
+	global := globalEncoders.Load()
+	if len(st.f.encoders) == 0 && global == nil || v == nil {
+		return Encoder{}, false
+	}
+	t := reflect.TypeOf(v)
+	if e, ok := st.f.encoders[t]; ok {
+		return e, true
+	}
+	if global != nil {
+		e, ok := (*global)[t]
+		return e, ok
+	}
+	return Encoder{}, false
+}
+
+// appendValue appends the value encoded by the single-value encoder.
+func (e Encoder) appendValue(dst []byte, v any) ([]byte, bool, error) {
+	if e.encode == nil {
+		return dst, false, fmt.Errorf("multi-value encoder of %s is available only in path and query values", e.typ)
+	}
+	if isNilPointer(v) {
+		return dst, false, nil
+	}
+	s, err := e.encode(v)
+	if err != nil {
+		return dst, false, fmt.Errorf("encode failed: %w", err)
+	}
+	return append(dst, s...), true, nil
+}
+
+// values returns the values of the encoder. The single-value encoder returns one value.
+func (e Encoder) values(v any) ([]string, error) {
+	if isNilPointer(v) {
+		return nil, nil
+	}
+	if e.multi == nil {
+		s, err := e.encode(v)
+		if err != nil {
+			return nil, fmt.Errorf("encode failed: %w", err)
+		}
+		return []string{s}, nil
+	}
+	values, err := e.multi(v)
+	if err != nil {
+		return nil, fmt.Errorf("encode failed: %w", err)
+	}
+	return values, nil
+}
+
+func isNilPointer(v any) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
@@ -0,0 +1,90 @@
+package urlf
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type vendorID struct {
+	prefix string
+	n      int
+}
+
+type region struct {
+	country, city string
+}
+
+func init() {
+	RegisterEncoder(func(v vendorID) (string, error) {
+		if v.prefix == "" {
+			return "", errors.New("empty prefix")
+		}
+		return fmt.Sprintf("%s-%04d", strings.ToUpper(v.prefix), v.n), nil
+	})
+	RegisterMultiEncoder(func(r region) ([]string, error) {
+		return []string{r.country, r.city}, nil
+	})
+}
+
+func TestEncoder(t *testing.T) {
+	bytesEncoder := NewEncoder(func(b []byte) (string, error) {
+		return base64.RawURLEncoding.EncodeToString(b), nil
+	})
+	dateEncoder := NewEncoder(func(t time.Time) (string, error) {
+		return t.Format(time.DateOnly), nil
+	})
+	tests := []formatCase{
+		{name: "global", format: "https://example.com/vendors/{}?id={}#{}", args: []any{vendorID{"ab", 1}, vendorID{"cd", 2}, vendorID{"ef", 3}}, want: "https://example.com/vendors/AB-0001?id=CD-0002#EF-0003"},
+		{name: "in slices", format: "https://example.com/{}?id={}", args: []any{[]vendorID{{"a", 1}, {"b", 2}}, []any{vendorID{"c", 3}}}, want: "https://example.com/A-0001/B-0002?id=C-0003"},
+		{name: "bytes", opt: Opt{Encoders: []Encoder{bytesEncoder}}, format: "https://example.com/blobs/{}?h={}", args: []any{[]byte("hello"), []byte{0xff, 0xfe}}, want: "https://example.com/blobs/aGVsbG8?h=__4"},
+		{name: "override built-in", opt: Opt{Encoders: []Encoder{dateEncoder}}, format: "https://example.com/reports/{}", args: []any{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}, want: "https://example.com/reports/2024-01-02"},
+		{name: "override global", opt: Opt{Encoders: []Encoder{NewEncoder(func(v vendorID) (string, error) { return v.prefix, nil })}}, format: "https://example.com/{}", args: []any{vendorID{"ab", 1}}, want: "https://example.com/ab"},
+		{name: "multi path", format: "https://example.com/shops/{}/items", args: []any{region{"japan", "tokyo"}}, want: "https://example.com/shops/japan/tokyo/items"},
+		{name: "multi query", format: "https://example.com/?r={}&r=static", args: []any{region{"japan", "tokyo"}}, want: "https://example.com/?r=japan&r=tokyo&r=static"},
+		{name: "nil pointer", format: "https://example.com/{}?id={}", args: []any{(*vendorID)(nil), (*vendorID)(nil)}, want: "https://example.com/"},
+	}
+	testFormat(t, tests)
+}
+
+func TestEncoderError(t *testing.T) {
+	tests := []formatErrorCase{
+		{name: "encode failed", format: "https://example.com/{}", args: []any{vendorID{}}, wantMsg: "encode failed: empty prefix"},
+		{name: "multi in fragment", format: "https://example.com/#{}", args: []any{region{"japan", "tokyo"}}, wantMsg: "multi-value encoder of urlf.region is available only in path and query values"},
+		{name: "multi in query key", format: "https://example.com/?{}=1", args: []any{region{"japan", "tokyo"}}, wantMsg: "query key of '{}': multi-value encoder of urlf.region is available only in path and query values"},
+	}
+	testFormatError(t, tests)
+}
+
+type categoryPath []string
+
+func (c categoryPath) URLSegments() []string {
+	return c
+}
+
+type searchFilter struct {
+	Word     string
+	MaxPrice int
+}
+
+func (f *searchFilter) URLQuery() url.Values {
+	q := url.Values{"word": {f.Word}}
+	if f.MaxPrice > 0 {
+		q.Set("max_price", strconv.Itoa(f.MaxPrice))
+	}
+	return q
+}
+
+func TestExpansionInterfaces(t *testing.T) {
+	tests := []formatCase{
+		{name: "path segmenter", format: "https://example.com/categories/{}/items", args: []any{categoryPath{"foods", "sweets"}}, want: "https://example.com/categories/foods/sweets/items"},
+		{name: "query encoder", format: "https://example.com/search?{}&page={}", args: []any{&searchFilter{Word: "cake", MaxPrice: 500}, 2}, want: "https://example.com/search?max_price=500&page=2&word=cake"},
+		{name: "nil query encoder", format: "https://example.com/search?{}", args: []any{(*searchFilter)(nil)}, want: "https://example.com/search"},
+	}
+	testFormat(t, tests)
+}
@@ -0,0 +1,100 @@
+package urlf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseError is an error of the URL template.
+//
+// errors.Is(err, ErrParseFailed) returns true for it.
+type ParseError struct {
+	Template string
+	Offset   int    // byte offset of the invalid text in Template
+	Part     string // URL part: "protocol", "userinfo", "hostname", "port", "path", "query" or "fragment"
+	Reason   string
+}
+
+func newParseError(template string, offset int, part, format string, args ...any) *ParseError {
+	return &ParseError{Template: template, Offset: offset, Part: part, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Error returns the message with the template and a caret under the invalid text.
+func (e *ParseError) Error() string {
+	return "parse failed: " + e.Reason + caret(e.Template, e.Offset)
+}
+
+func (e *ParseError) Unwrap() error {
+	return ErrParseFailed
+}
+
+// FormatError is an error of the placeholder value.
+//
+// errors.Is(err, ErrFormatFailed) returns true for it.
+type FormatError struct {
+	Template         string
+	PlaceholderIndex int
+	Part             string // URL part: "protocol", "userinfo", "hostname", "port", "path", "query" or "fragment"
+	Value            any
+	Reason           string
+}
+
+func newFormatError(index int, part string, value any, format string, args ...any) *FormatError {
+	return &FormatError{PlaceholderIndex: index, Part: part, Value: value, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Error returns the message with the template and a caret under the placeholder.
+func (e *FormatError) Error() string {
+	offset := -1
+	for _, t := range scan(e.Template) {
+		if t.tokenType == placeholder && t.index == e.PlaceholderIndex {
+			offset = t.offset
+			break
+		}
+	}
+	var value string
+	if isComposite(e.Value) { // maps and structs can be large or self-referencing
+		value = fmt.Sprintf("(%T)", e.Value)
+	} else {
+		value = fmt.Sprintf("'%v' (%T)", e.Value, e.Value)
+	}
+	return fmt.Sprintf("format failed: invalid %s value %s for placeholder {%d}: %s", e.Part, value, e.PlaceholderIndex, e.Reason) + caret(e.Template, offset)
+}
+
+// isComposite reports whether the value is a map, a struct, a slice or an array without its own text.
+func isComposite(v any) bool {
+	if v == nil || hasText(v) {
+		return false
+	}
+	switch reflect.Indirect(reflect.ValueOf(v)).Kind() {
+	case reflect.Map, reflect.Struct, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
+
+func (e *FormatError) Unwrap() error {
+	return ErrFormatFailed
+}
+
+// caret returns lines of the template and a caret under the offset.
+func caret(template string, offset int) string {
+	if template == "" || offset < 0 {
+		return ""
+	}
+	offset = min(offset, len(template))
+	return "\n\t" + template + "\n\t" + strings.Repeat(" ", utf8.RuneCountInString(template[:offset])) + "^"
+}
+
+// mustError adds the template to the error for panic of "Must" functions if the error doesn't have it.
+func mustError(format string, err error) error {
+	var pe *ParseError
+	var fe *FormatError
+	if errors.As(err, &pe) || errors.As(err, &fe) {
+		return err
+	}
+	return fmt.Errorf("%w\n\t%s", err, format)
+}
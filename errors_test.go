@@ -0,0 +1,105 @@
+package urlf
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestParseErrorFields(t *testing.T) {
+	_, err := TryUrlf("http://example.com:abc/")
+	assert.IsError(t, err, ErrParseFailed)
+	var pe *ParseError
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, "http://example.com:abc/", pe.Template)
+	assert.Equal(t, 19, pe.Offset)
+	assert.Equal(t, "port", pe.Part)
+	assert.Equal(t, "port must be a number, but 'abc'", pe.Reason)
+	assert.Equal(t, "parse failed: port must be a number, but 'abc'\n\thttp://example.com:abc/\n\t                   ^", err.Error())
+}
+
+func TestFormatErrorFields(t *testing.T) {
+	_, err := TryUrlf("http://{}/path", 10)
+	assert.IsError(t, err, ErrFormatFailed)
+	assert.False(t, errors.Is(err, ErrParseFailed))
+	var fe *FormatError
+	assert.True(t, errors.As(err, &fe))
+	assert.Equal(t, "http://{}/path", fe.Template)
+	assert.Equal(t, 0, fe.PlaceholderIndex)
+	assert.Equal(t, "hostname", fe.Part)
+	assert.Equal(t, any(10), fe.Value)
+	assert.Equal(t, "only string is available", fe.Reason)
+	assert.Equal(t, "format failed: invalid hostname value '10' (int) for placeholder {0}: only string is available\n\thttp://{}/path\n\t       ^", err.Error())
+}
+
+func TestCaret(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		offset   int
+		want     string
+	}{
+		{name: "head", template: "/{}", offset: 0, want: "\n\t/{}\n\t^"},
+		{name: "multibyte", template: "/ä/{}", offset: 4, want: "\n\t/ä/{}\n\t   ^"},
+		{name: "end", template: "/a", offset: 10, want: "\n\t/a\n\t  ^"},
+		{name: "no offset", template: "/a", offset: -1, want: ""},
+		{name: "no template", template: "", offset: 0, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, caret(tt.template, tt.offset))
+		})
+	}
+}
+
+func TestMustPanic(t *testing.T) {
+	panicValue := func(fn func()) (v any) {
+		defer func() { v = recover() }()
+		fn()
+		return nil
+	}
+
+	v := panicValue(func() { Urlf("http://example.com:abc/") })
+	err, ok := v.(error)
+	assert.True(t, ok)
+	assert.IsError(t, err, ErrParseFailed)
+	assert.Equal(t, "parse failed: port must be a number, but 'abc'\n\thttp://example.com:abc/\n\t                   ^", err.Error())
+
+	v = panicValue(func() { Urlf("http://{}/path", 10) })
+	err, ok = v.(error)
+	assert.True(t, ok)
+	assert.IsError(t, err, ErrFormatFailed)
+
+	// errors without the template get it for the message
+	err = mustError("http://example.com/", fmt.Errorf("%w: invalid option", ErrParseFailed))
+	assert.IsError(t, err, ErrParseFailed)
+	assert.Equal(t, "parse failed: invalid option\n\thttp://example.com/", err.Error())
+}
+
+func TestMissingArgument(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		args      []any
+		wantIndex int
+		wantPart  string
+	}{
+		{name: "query", format: "http://h/?a={}", wantIndex: 0, wantPart: "query"},
+		{name: "path", format: "http://h/{}/{}", args: []any{1}, wantIndex: 1, wantPart: "path"},
+		{name: "port", format: "http://h:{}/#{}", wantIndex: 0, wantPart: "port"},
+		{name: "query key", format: "http://h/?{}={}", args: []any{"k"}, wantIndex: 1, wantPart: "query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := TryUrlf(tt.format, tt.args...)
+			assert.IsError(t, err, ErrFormatFailed)
+			var fe *FormatError
+			assert.True(t, errors.As(err, &fe))
+			assert.Equal(t, tt.wantIndex, fe.PlaceholderIndex)
+			assert.Equal(t, tt.wantPart, fe.Part)
+			assert.Equal(t, fmt.Sprintf("missing argument: only %d arguments are given", len(tt.args)), fe.Reason)
+		})
+	}
+}
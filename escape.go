@@ -0,0 +1,78 @@
+package urlf
+
+// encoding is a URL part that has its own escaping rule. It mirrors the rules of net/url.
+type encoding uint8
+
+const (
+	encodePath encoding = 1 << iota
+	encodeHost
+	encodeUserPassword
+	encodeQueryComponent
+	encodeFragment
+)
+
+const upperhex = "0123456789ABCDEF"
+
+// escapeTable has bits of the encodings that don't escape the character.
+var escapeTable [256]encoding
+
+func init() {
+	for c := 0; c < 256; c++ {
+		for _, mode := range []encoding{encodePath, encodeHost, encodeUserPassword, encodeQueryComponent, encodeFragment} {
+			if !shouldEscapeSlow(byte(c), mode) {
+				escapeTable[c] |= mode
+			}
+		}
+	}
+}
+
+// shouldEscapeSlow is same as shouldEscape in net/url. It is used to build escapeTable.
+func shouldEscapeSlow(c byte, mode encoding) bool {
+	if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+		return false
+	}
+	if mode == encodeHost {
+		switch c {
+		case '!', '$', '&', '\'', '(', ')', '*', '+', ',', ';', '=', ':', '[', ']', '<', '>', '"':
+			return false
+		}
+	}
+	switch c {
+	case '-', '_', '.', '~':
+		return false
+	case '$', '&', '+', ',', '/', ':', ';', '=', '?', '@':
+		switch mode {
+		case encodePath:
+			return c == '?'
+		case encodeUserPassword:
+			return c == '@' || c == '/' || c == '?' || c == ':'
+		case encodeQueryComponent:
+			return true
+		case encodeFragment:
+			return false
+		}
+	}
+	if mode == encodeFragment {
+		switch c {
+		case '!', '(', ')', '*':
+			return false
+		}
+	}
+	return true
+}
+
+// appendEscape appends the escaped string to dst like url.QueryEscape and url.URL.String do.
+func appendEscape[T string | []byte](dst []byte, s T, mode encoding) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escapeTable[c]&mode != 0:
+			dst = append(dst, c)
+		case c == ' ' && mode == encodeQueryComponent:
+			dst = append(dst, '+')
+		default:
+			dst = append(dst, '%', upperhex[c>>4], upperhex[c&15])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,25 @@
+package urlf
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestAppendEscape(t *testing.T) {
+	var all []byte
+	for c := 0; c < 256; c++ {
+		all = append(all, byte(c))
+	}
+	inputs := []string{string(all), "a b/c?d#e@f:g", "🐙/東京", "*"}
+	for _, s := range inputs {
+		assert.Equal(t, url.QueryEscape(s), string(appendEscape(nil, s, encodeQueryComponent)))
+		assert.Equal(t, (&url.URL{Fragment: s}).EscapedFragment(), string(appendEscape(nil, s, encodeFragment)))
+		assert.Equal(t, url.UserPassword(s, s).String(), string(appendEscape(nil, s, encodeUserPassword))+":"+string(appendEscape(nil, s, encodeUserPassword)))
+		assert.Equal(t, "//"+string(appendEscape(nil, s, encodeHost)), (&url.URL{Host: s}).String())
+		if s != "*" {
+			assert.Equal(t, (&url.URL{Path: s}).EscapedPath(), string(appendEscape(nil, s, encodePath)))
+		}
+	}
+}
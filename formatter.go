@@ -1,14 +1,18 @@
 package urlf
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"reflect"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 var ErrFormatFailed = errors.New("format failed")
@@ -18,8 +22,46 @@ type Opt struct {
 	Hostname string
 	Port     uint16
 	Protocol string
+	// Username overwrites the username in the template. If Password is empty, only the username is used.
 	Username string
 	Password string
+	// Userinfo overwrites the userinfo in the template.
+	// Use it instead of Username and Password to distinguish url.User (no password)
+	// and url.UserPassword with an empty password.
+	Userinfo *url.Userinfo
+	// OmitUserinfo removes the userinfo in the template and the userinfo options above.
+	OmitUserinfo bool
+	// RedactKeys is a list of query keys that are masked in Result.Redacted.
+	// If it is nil, DefaultRedactKeys is used.
+	RedactKeys []string
+	// Signer signs every URL the formatter produces.
+	Signer Signer
+	// Cache is a template cache for the formatter. If it is nil, the shared cache (DefaultCache) is used.
+	Cache *Cache
+	// Middlewares wrap every formatting of the formatter. See Middleware.
+	Middlewares []Middleware
+	// FloatFormat is the format of float values for strconv.FormatFloat like 'f', 'e' or 'g'. The default is 'f'.
+	FloatFormat byte
+	// FloatPrecision is the precision of float values like strconv.FormatFloat. 0 is a valid precision.
+	// If it is nil, the smallest number of digits necessary to represent the value is used.
+	FloatPrecision *int
+	// Encoders are custom encoders for the formatter. They have priority over the ones of RegisterEncoder.
+	Encoders []Encoder
+	// TimeFormat is the format of time.Time and time.Duration values like TimeUnix or a layout like "2006-01-02".
+	// The default is TimeRFC3339. Placeholders can override it like {:unixms}.
+	TimeFormat string
+	// TimeLocation is the time zone of time.Time values. The default is UTC.
+	TimeLocation *time.Location
+	// OmitDefaultQuery removes query parameters whose values are the defaults of the placeholders like page={=1}.
+	OmitDefaultQuery bool
+	// OmitEmpty treats zero values like "", 0, false and empty slices and maps as nil.
+	OmitEmpty bool
+	// ArrayStyle is the encoding of slices in query values like ArrayComma. The default is ArrayRepeat.
+	// Placeholders can override it like ids={,}.
+	ArrayStyle ArrayStyle
+	// PreserveQueryOrder writes query parameters in the order of the template instead of sorting them by key.
+	// Keys of a query set placeholder are sorted because url.Values has no order.
+	PreserveQueryOrder bool
 }
 
 // CustomFormatter is a custom formatter function.
@@ -32,234 +74,899 @@ func CustomFormatter(o Opt) func(format string, args ...any) string {
 	f := TryCustomFormatter(o)
 	return func(format string, args ...any) string {
 		if result, err := f(format, args...); err != nil {
-			panic(err)
+			panic(mustError(format, err))
 		} else {
 			return result
 		}
 	}
 }
 
-var cache = sync.Map{}
-
 // TryCustomFormatter generates a custom formatter function that returns an empty string.
 func TryCustomFormatter(o Opt) func(format string, args ...any) (string, error) {
+	f := newFormatter(o)
 	return func(format string, args ...any) (string, error) {
-		var ot *parseResult // original template
-		if v, ok := cache.Load(format); ok {
-			ot = v.(*parseResult)
+		return f.format(format, args)
+	}
+}
+
+// AppendURL appends the formatted URL to dst and returns the extended buffer like strconv.Append* functions.
+//
+// It reuses dst and doesn't allocate a string for each URL.
+// If the format is invalid, it returns dst unchanged and an error.
+func AppendURL(dst []byte, format string, args ...any) ([]byte, error) {
+	return defaultFormatter.appendURL(dst, format, nil, args)
+}
+
+// WriteURL writes the formatted URL to w. It returns the number of bytes written.
+func WriteURL(w io.Writer, format string, args ...any) (int, error) {
+	return defaultFormatter.writeURL(w, format, args)
+}
+
+// formatter is a formatting engine shared by TryCustomFormatter and Formatter.
+type formatter struct {
+	cache  *Cache
+	ov     *overrides
+	err    error // error of Opt. It is reported when formatting
+	signer Signer
+
+	middlewares []Middleware
+	handler     FormatFunc // middlewares chain. It is nil if there are no middlewares
+
+	floatFormat byte
+	floatPrec   int
+	encoders    map[reflect.Type]Encoder
+
+	timeFormat   string
+	timeLocation *time.Location
+
+	omitDefaultQuery bool
+	omitEmpty        bool
+	preserveOrder    bool // Opt.PreserveQueryOrder
+	arrayStyle       ArrayStyle
+}
+
+func newFormatter(o Opt) *formatter {
+	f := &formatter{
+		cache:        o.Cache,
+		signer:       o.Signer,
+		floatFormat:  o.FloatFormat,
+		floatPrec:    -1,
+		timeFormat:   o.TimeFormat,
+		timeLocation: o.TimeLocation,
+
+		omitDefaultQuery: o.OmitDefaultQuery,
+		omitEmpty:        o.OmitEmpty,
+		preserveOrder:    o.PreserveQueryOrder,
+		arrayStyle:       o.ArrayStyle,
+	}
+	if f.cache == nil {
+		f.cache = defaultCache
+	}
+	if f.floatFormat == 0 {
+		f.floatFormat = 'f'
+	}
+	if o.FloatPrecision != nil {
+		f.floatPrec = *o.FloatPrecision
+	}
+	if f.timeLocation == nil {
+		f.timeLocation = time.UTC
+	}
+	if len(o.Encoders) > 0 {
+		f.encoders = make(map[reflect.Type]Encoder, len(o.Encoders))
+		for _, e := range o.Encoders {
+			f.encoders[e.typ] = e
+		}
+	}
+	f.ov, f.err = newOverrides(o)
+	if err := checkTimeFormat(o.TimeFormat); err != nil && f.err == nil {
+		f.err = fmt.Errorf("%w: %w", ErrParseFailed, err)
+	}
+	if (o.ArrayStyle < 0 || o.ArrayStyle > ArrayIndexed) && f.err == nil {
+		f.err = fmt.Errorf("%w: unknown array style %d", ErrParseFailed, o.ArrayStyle)
+	}
+	f.use(o.Middlewares)
+	return f
+}
+
+func (f *formatter) format(format string, args []any) (string, error) {
+	st := statePool.Get().(*formatState)
+	defer st.release()
+	var err error
+	st.out, err = f.appendURL(st.out[:0], format, nil, args)
+	if err != nil {
+		return "", err
+	}
+	return string(st.out), nil
+}
+
+func (f *formatter) writeURL(w io.Writer, format string, args []any) (int, error) {
+	st := statePool.Get().(*formatState)
+	defer st.release()
+	var err error
+	st.out, err = f.appendURL(st.out[:0], format, nil, args)
+	if err != nil {
+		return 0, err
+	}
+	return w.Write(st.out)
+}
+
+// appendURL appends the formatted URL to dst.
+func (f *formatter) appendURL(dst []byte, format string, ot *parseResult, args []any) ([]byte, error) {
+	if f.handler == nil && f.signer == nil {
+		return f.appendTemplate(dst, format, ot, args)
+	}
+	c := &Call{Template: format, Args: args, parsed: ot, parsedTemplate: format}
+	var u *url.URL
+	var err error
+	if f.handler != nil {
+		u, err = f.handler(c)
+	} else {
+		u, err = f.build(c)
+	}
+	if err != nil {
+		return dst, err
+	}
+	if f.signer != nil {
+		if err := f.signer.Sign(u); err != nil {
+			return dst, fmt.Errorf("%w: sign failed: %w", ErrFormatFailed, err)
+		}
+	}
+	return append(dst, u.String()...), nil
+}
+
+// appendTemplate appends the URL of the template to dst without middlewares and the signer.
+// ot is the parsed template of format, or nil to get it from the cache.
+func (f *formatter) appendTemplate(dst []byte, format string, ot *parseResult, args []any) ([]byte, error) {
+	var err error
+	if ot == nil {
+		ot, err = f.cache.get(format) // original template
+		if err != nil {
+			return dst, err
+		}
+	}
+	if f.err != nil {
+		return dst, f.err
+	}
+	t := f.ov.apply(ot)
+
+	st := statePool.Get().(*formatState)
+	defer st.release()
+	st.f = f
+	start := len(dst)
+	dst, err = st.appendURL(dst, &t, args)
+	if err != nil {
+		var fe *FormatError
+		if errors.As(err, &fe) {
+			fe.Template = format
+		}
+		return dst[:start], err
+	}
+	return dst, nil
+}
+
+// formatState is a reusable work area of formatting. It is pooled to avoid allocations.
+type formatState struct {
+	f        *formatter
+	out      []byte // output buffer for TryCustomFormatter
+	path     []byte // escaped path
+	scratch  []byte // unescaped query keys and values
+	text     []byte // unescaped text of a value
+	pairs    []queryPair
+	sections []int // path lengths at the start of the open optional path sections
+}
+
+// queryPair is a query key and value in formatState.scratch.
+type queryPair struct {
+	k0, k1 int // key is scratch[k0:k1]
+	v0, v1 int // value is scratch[v0:v1]
+
+	escaped bool // value is already escaped like delimited arrays
+}
+
+var statePool = sync.Pool{
+	New: func() any {
+		return &formatState{}
+	},
+}
+
+func (st *formatState) release() {
+	st.f = nil
+	st.path = st.path[:0]
+	st.scratch = st.scratch[:0]
+	st.text = st.text[:0]
+	st.pairs = st.pairs[:0]
+	st.sections = st.sections[:0]
+	statePool.Put(st)
+}
+
+func (st *formatState) appendURL(dst []byte, t *parseResult, args []any) ([]byte, error) {
+	if err := missingArg(t, len(args)); err != nil {
+		return dst, err
+	}
+	var scheme, host string
+	var port []byte
+	var portBuf [8]byte
+
+	// Scheme
+	if t.protocol != nil {
+		if t.protocol.partType == staticPart {
+			scheme = t.protocol.value
 		} else {
-			var err error
-			ot, err = parse(format)
+			arg, _, err := resolveArg(st, *t.protocol, "protocol", args[t.protocol.index])
+			if err != nil {
+				return dst, err
+			}
+			v, _, err := textValue(arg)
 			if err != nil {
-				return "", err
+				return dst, newFormatError(t.protocol.index, "protocol", args[t.protocol.index], "%v", err)
 			}
-			cache.Store(format, ot)
+			scheme = v
 		}
-		t, err := overwrite(ot, o)
-		if err != nil {
-			return "", err
+	}
+
+	// Host
+	if t.hostname != nil {
+		if t.hostname.partType == staticPart {
+			host = t.hostname.value
+		} else {
+			arg, _, err := resolveArg(st, *t.hostname, "hostname", args[t.hostname.index])
+			if err != nil {
+				return dst, err
+			}
+			v, ok, err := textValue(arg)
+			if err != nil {
+				return dst, newFormatError(t.hostname.index, "hostname", args[t.hostname.index], "%v", err)
+			}
+			if ok {
+				host = v
+			} else { // omit scheme too
+				scheme = ""
+			}
 		}
-		r := &url.URL{}
+	}
 
-		// Scheme
-		if t.protocol != nil {
-			if t.protocol.partType == staticPart {
-				r.Scheme = t.protocol.value
-			} else {
-				switch v := args[t.protocol.index].(type) {
-				case string:
-					r.Scheme = v
-				case *string:
-					r.Scheme = *v
-				case nil:
-					// do nothing
-				default:
-					return "", fmt.Errorf("%w: invalid protocol value. only string param is available, but '%v'", ErrFormatFailed, args[t.protocol.index])
-				}
+	// Port
+	if t.port != nil && host != "" {
+		if t.port.partType == staticPart {
+			port = strconv.AppendUint(portBuf[:0], uint64(t.port.value), 10)
+		} else {
+			arg, isDefault, err := resolveArg(st, *t.port, "port", args[t.port.index])
+			if err != nil {
+				return dst, err
+			}
+			if isDefault {
+				arg = json.Number(arg.(string)) // validated by the parser
+			}
+			p, ok, err := appendPort(portBuf[:0], arg)
+			if err != nil {
+				return dst, newFormatError(t.port.index, "port", args[t.port.index], "%v", err)
+			}
+			if ok {
+				port = p
 			}
 		}
+	}
 
-		// Host
-		if t.hostname != nil {
-			if t.hostname.partType == staticPart {
-				r.Host = t.hostname.value
-			} else {
-				switch v := args[t.hostname.index].(type) {
-				case string:
-					r.Host = v
-				case *string:
-					r.Host = *v
-				case nil: // omit scheme too
-					r.Scheme = ""
-				default:
-					return "", fmt.Errorf("%w: invalid hostname value. only string param is available, but '%v'", ErrFormatFailed, args[t.hostname.index])
-				}
+	// Path
+	for i := 0; i < len(t.paths); i++ {
+		p := t.paths[i]
+		switch p.partType {
+		case staticPart:
+			st.appendPath(false, p.value)
+			continue
+		case optionalStart:
+			st.sections = append(st.sections, len(st.path))
+			continue
+		case optionalEnd:
+			st.sections = st.sections[:len(st.sections)-1]
+			continue
+		}
+		arg, isDefault, err := resolveArg(st, p, "path", args[p.index])
+		if err != nil {
+			return dst, err
+		}
+		if n := len(st.sections); n > 0 && (arg == nil || isNilPointer(arg)) {
+			// nil removes the innermost optional section with its static text
+			st.path = st.path[:st.sections[n-1]]
+			st.sections = st.sections[:n-1]
+			i = sectionEnd(t.paths, i)
+			continue
+		}
+		if isDefault {
+			p.spec = nil
+		}
+		if err := st.appendPathArg(p, arg); err != nil {
+			return dst, err
+		}
+	}
+
+	// Query
+	for _, q := range t.queries {
+		if q.keyParts != nil {
+			k0, k1, ok, err := st.appendQueryKey(q, args)
+			if err != nil {
+				return dst, err
 			}
+			if !ok { // nil key drops the pair
+				continue
+			}
+			if q.value.partType == staticPart {
+				st.addQuery(k0, k1, q.value.value)
+			} else if err := st.updateQueryArg(k0, k1, q.value, args); err != nil {
+				return dst, err
+			}
+		} else if q.value.partType == staticPart {
+			k0, k1 := st.appendKey(q.key)
+			st.addQuery(k0, k1, q.value.value)
+		} else if q.key != "" {
+			k0, k1 := st.appendKey(q.key)
+			if err := st.updateQueryArg(k0, k1, q.value, args); err != nil {
+				return dst, err
+			}
+		} else if arg, _, err := resolveArg(st, q.value, "query", args[q.value.index]); err != nil {
+			return dst, err
+		} else if err := st.addQuerySet(q.value.index, arg); err != nil {
+			return dst, err
 		}
+	}
 
-		// Port
-		if t.port != nil && r.Host != "" {
-			if t.port.partType == staticPart {
-				r.Host += ":" + strconv.Itoa(int(t.port.value))
-			} else {
-				switch v := args[t.port.index].(type) {
-				case int:
-					r.Host += ":" + strconv.Itoa(v)
-				case *int:
-					r.Host += ":" + strconv.Itoa(*v)
-				case nil:
-					// do nothing
-				default:
-					return "", fmt.Errorf("%w: invalid port value. only int param is available, but '%v'", ErrFormatFailed, args[t.port.index])
-				}
+	// Fragment
+	var fragment []byte
+	if t.fragment != nil {
+		if t.fragment.partType == staticPart {
+			fragment = append(st.text[:0], t.fragment.value...)
+		} else {
+			arg, isDefault, err := resolveArg(st, *t.fragment, "fragment", args[t.fragment.index])
+			if err != nil {
+				return dst, err
 			}
+			spec := t.fragment.spec
+			if isDefault {
+				spec = nil
+			}
+			st.text, _, err = st.appendValue(st.text[:0], arg, spec)
+			if err != nil {
+				return dst, newFormatError(t.fragment.index, "fragment", args[t.fragment.index], "%v", err)
+			}
+			fragment = st.text
 		}
+	}
 
-		// Path
-		var paths []string
-		for _, p := range t.paths {
-			if p.partType == staticPart {
-				paths = append(paths, p.value)
+	// Userinfo
+	var username, password string
+	hasUsername, hasPassword := false, false
+	if t.username != nil && host != "" {
+		if t.username.partType == staticPart {
+			username, hasUsername = t.username.value, true
+		} else {
+			arg, _, err := resolveArg(st, *t.username, "userinfo", args[t.username.index])
+			if err != nil {
+				return dst, err
+			}
+			v, ok, err := textValue(arg)
+			if err != nil {
+				return dst, newFormatError(t.username.index, "userinfo", args[t.username.index], "%v", err)
+			}
+			username, hasUsername = v, ok // nil omits userinfo
+		}
+		if hasUsername && t.password != nil {
+			if t.password.partType == staticPart {
+				password, hasPassword = t.password.value, true
 			} else {
-				// todo error check
-				v := args[p.index]
-				switch v2 := v.(type) {
-				case string:
-					paths = append(paths, v2)
-				case *string:
-					paths = append(paths, *v2)
-				case int:
-					paths = append(paths, strconv.Itoa(v2))
-				case *int:
-					paths = append(paths, strconv.Itoa(*v2))
-				case nil:
-					// do nothing
-				default:
-					rv := reflect.ValueOf(v)
-					if rv.Kind() == reflect.Slice {
-						for i := 0; i < rv.Len(); i++ {
-							switch ev := rv.Index(i).Interface().(type) {
-							case string:
-								paths = append(paths, "/"+ev)
-							case *string:
-								paths = append(paths, "/"+*ev)
-							case int:
-								paths = append(paths, "/"+strconv.Itoa(ev))
-							case *int:
-								paths = append(paths, "/"+strconv.Itoa(*ev))
-							case nil:
-								// do nothing
-							}
-						}
-					}
+				arg, _, err := resolveArg(st, *t.password, "userinfo", args[t.password.index])
+				if err != nil {
+					return dst, err
+				}
+				v, ok, err := textValue(arg)
+				if err != nil {
+					return dst, newFormatError(t.password.index, "userinfo", args[t.password.index], "%v", err)
 				}
+				password, hasPassword = v, ok // nil means username only
+			}
+		}
+	}
 
+	// Write URL in the same way as url.URL.String()
+	start := len(dst)
+	if scheme != "" {
+		dst = append(dst, scheme...)
+		dst = append(dst, ':')
+	}
+	if scheme != "" || host != "" || hasUsername {
+		if host != "" || len(st.path) > 0 || hasUsername {
+			dst = append(dst, "//"...)
+		}
+		if hasUsername {
+			dst = appendEscape(dst, username, encodeUserPassword)
+			if hasPassword {
+				dst = append(dst, ':')
+				dst = appendEscape(dst, password, encodeUserPassword)
+			}
+			dst = append(dst, '@')
+		}
+		if host != "" {
+			dst = appendEscape(dst, host, encodeHost)
+			if port != nil {
+				dst = append(dst, ':')
+				dst = append(dst, port...)
 			}
 		}
+	}
+	path := st.path
+	if string(path) == "%2A" { // url.URL doesn't escape "*" path
+		path = path[:0]
+		path = append(path, '*')
+	}
+	if len(path) > 0 && path[0] != '/' && host != "" {
+		dst = append(dst, '/')
+	}
+	if len(dst) == start {
+		segment, _, _ := bytes.Cut(path, []byte{'/'})
+		if bytes.IndexByte(segment, ':') >= 0 {
+			dst = append(dst, "./"...)
+		}
+	}
+	dst = append(dst, path...)
+	dst = st.appendQuery(dst)
+	if len(fragment) > 0 {
+		dst = append(dst, '#')
+		dst = appendEscape(dst, fragment, encodeFragment)
+	}
+	return dst, nil
+}
 
-		// Query
-		query := url.Values{}
-
-		updateQuery := func(key string, value any) error {
-			switch v := value.(type) {
-			case string:
-				query.Add(key, v)
-			case *string:
-				query.Add(key, *v)
-			case int:
-				query.Add(key, strconv.Itoa(v))
-			case *int:
-				query.Add(key, strconv.Itoa(*v))
-			case nil:
-			default:
-				rv := reflect.ValueOf(v)
-				if rv.Kind() == reflect.Slice {
-					for i := 0; i < rv.Len(); i++ {
-						switch ev := rv.Index(i).Interface().(type) {
-						case string:
-							if i == 0 {
-								query.Set(key, ev)
-							} else {
-								query.Add(key, ev)
-							}
-						case *string:
-							if i == 0 {
-								query.Set(key, *ev)
-							} else {
-								query.Add(key, *ev)
-							}
-						case int:
-							if i == 0 {
-								query.Set(key, strconv.Itoa(ev))
-							} else {
-								query.Add(key, strconv.Itoa(ev))
-							}
-						case *int:
-							if i == 0 {
-								query.Set(key, strconv.Itoa(*ev))
-							} else {
-								query.Add(key, strconv.Itoa(*ev))
-							}
-						case nil:
-							// do nothing
-						}
-					}
-				} else {
-					return fmt.Errorf("%w: query value must be string, int, nil, [](string|int), but '%v'", ErrFormatFailed, value)
-				}
+// missingArg returns an error for the first placeholder that has no argument.
+func missingArg(t *parseResult, n int) error {
+	index, name := -1, ""
+	check := func(p *part[string], part string) {
+		if p != nil && p.partType == paramPart && p.index >= n && (index < 0 || p.index < index) {
+			index, name = p.index, part
+		}
+	}
+	check(t.protocol, "protocol")
+	check(t.username, "userinfo")
+	check(t.password, "userinfo")
+	check(t.hostname, "hostname")
+	if t.port != nil && t.port.partType == paramPart {
+		check(&part[string]{partType: paramPart, index: t.port.index}, "port")
+	}
+	for i := range t.paths {
+		check(&t.paths[i], "path")
+	}
+	for i := range t.queries {
+		for j := range t.queries[i].keyParts {
+			check(&t.queries[i].keyParts[j], "query")
+		}
+		check(&t.queries[i].value, "query")
+	}
+	check(t.fragment, "fragment")
+	if index < 0 {
+		return nil
+	}
+	return newFormatError(index, name, nil, "missing argument: only %d arguments are given", n)
+}
+
+// resolveArg applies the marker of the placeholder to a nil value or a nil pointer.
+// {!} returns an error and {=value} returns the default text with isDefault = true.
+// Nullable types are unwrapped and zero values become nil with Opt.OmitEmpty before that.
+func resolveArg[T comparable](st *formatState, p part[T], name string, v any) (_ any, isDefault bool, err error) {
+	if nv, ok := st.nullValue(v); ok {
+		v = nv
+	}
+	if st.f.omitEmpty && isEmpty(v) {
+		v = nil
+	}
+	if !p.required && p.def == nil || v != nil && !isNilPointer(v) {
+		return v, false, nil
+	}
+	if p.required {
+		return v, false, newFormatError(p.index, name, v, "value is required")
+	}
+	return *p.def, true, nil
+}
+
+// sectionEnd returns the index of ']' of the optional path section that contains paths[i].
+func sectionEnd(paths []part[string], i int) int {
+	for depth := 1; depth > 0; {
+		i++
+		switch paths[i].partType {
+		case optionalStart:
+			depth++
+		case optionalEnd:
+			depth--
+		}
+	}
+	return i
+}
+
+// appendPath appends a path string. If slash is true, "/" is added before the string.
+// Like url.URL, a double slash between path parts is joined into a single slash.
+func (st *formatState) appendPath(slash bool, s string) {
+	st.path = appendPathText(st.path, slash, s)
+}
+
+func appendPathText[T string | []byte](path []byte, slash bool, s T) []byte {
+	endsWithSlash := len(path) > 0 && path[len(path)-1] == '/'
+	if slash {
+		if !endsWithSlash {
+			path = append(path, '/')
+		}
+	} else if len(s) > 0 && s[0] == '/' && endsWithSlash {
+		s = s[1:]
+	}
+	return appendEscape(path, s, encodePath)
+}
+
+func (st *formatState) appendPathInt(slash bool, v int) {
+	if slash && !st.endsWithSlash() {
+		st.path = append(st.path, '/')
+	}
+	st.path = strconv.AppendInt(st.path, int64(v), 10)
+}
+
+func (st *formatState) endsWithSlash() bool {
+	return len(st.path) > 0 && st.path[len(st.path)-1] == '/'
+}
+
+// appendPathArg appends a path placeholder value. Elements of slices are added as path segments.
+func (st *formatState) appendPathArg(p part[string], v any) error {
+	if p.spec == nil { // fast paths
+		switch v := v.(type) {
+		case string:
+			st.appendPath(false, v)
+			return nil
+		case []string:
+			for _, ev := range v {
+				st.appendPath(true, ev)
+			}
+			return nil
+		case []int:
+			for _, ev := range v {
+				st.appendPathInt(true, ev)
 			}
 			return nil
 		}
-		for _, q := range t.queries {
-			if q.value.partType == staticPart {
-				query.Add(q.key, q.value.value)
-			} else if q.key != "" {
-				if err := updateQuery(q.key, args[q.value.index]); err != nil {
-					return "", err
-				}
-			} else if vs, ok := args[q.value.index].(url.Values); ok {
-				for key, values := range vs {
-					if err := updateQuery(key, values); err != nil {
-						return "", err
-					}
+	}
+	if e, ok := st.encoder(v); ok {
+		if e.multi == nil {
+			return st.appendPathValue(false, p, v)
+		}
+		values, err := e.values(v)
+		if err != nil {
+			return newFormatError(p.index, "path", v, "%v", err)
+		}
+		for _, ev := range values {
+			st.appendPath(true, ev)
+		}
+		return nil
+	}
+	if ps, ok := v.(PathSegmenter); ok {
+		if !isNilPointer(ps) {
+			for _, ev := range ps.URLSegments() {
+				st.appendPath(true, ev)
+			}
+		}
+		return nil
+	}
+	switch v := v.(type) {
+	case []string:
+		for i, ev := range v {
+			if err := st.appendPathValue(true, p, ev); err != nil {
+				return elementError(err, i)
+			}
+		}
+	case []int:
+		for i, ev := range v {
+			if err := st.appendPathValue(true, p, ev); err != nil {
+				return elementError(err, i)
+			}
+		}
+	case []any:
+		for i, ev := range v {
+			if err := st.appendPathValue(true, p, ev); err != nil {
+				return elementError(err, i)
+			}
+		}
+	default:
+		// other slice types are rare and need reflection
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && !hasText(v) {
+			for i := 0; i < rv.Len(); i++ {
+				if err := st.appendPathValue(true, p, rv.Index(i).Interface()); err != nil {
+					return elementError(err, i)
 				}
-			} else {
-				return "", fmt.Errorf("%w: query set must be url.Values, but '%v'", ErrFormatFailed, args[q.value.index])
 			}
+			return nil
 		}
-		r.RawQuery = query.Encode()
+		return st.appendPathValue(false, p, v)
+	}
+	return nil
+}
 
-		if t.fragment != nil {
-			if t.fragment.partType == staticPart {
-				r.Fragment = t.fragment.value
-			} else {
-				switch v := args[t.fragment.index].(type) {
-				case string:
-					r.Fragment = v
-				case *string:
-					r.Fragment = *v
-				case nil:
-					// do nothing
-				default:
-					return "", fmt.Errorf("%w: fragment must be a string, but '%v'", ErrFormatFailed, args[t.fragment.index])
+// appendPathValue appends a scalar value as a path part.
+func (st *formatState) appendPathValue(slash bool, p part[string], v any) error {
+	var ok bool
+	var err error
+	st.text, ok, err = st.appendValue(st.text[:0], v, p.spec)
+	if err != nil {
+		return newFormatError(p.index, "path", v, "%v", err)
+	}
+	if ok {
+		st.path = appendPathText(st.path, slash, st.text)
+	}
+	return nil
+}
+
+// elementError adds the position in the slice to the reason.
+func elementError(err error, i int) error {
+	var fe *FormatError
+	if errors.As(err, &fe) {
+		fe.Reason = fmt.Sprintf("element %d: %s", i, fe.Reason)
+	}
+	return err
+}
+
+// appendKey stores the query key in scratch and returns its position.
+func (st *formatState) appendKey(key string) (int, int) {
+	k0 := len(st.scratch)
+	st.scratch = append(st.scratch, key...)
+	return k0, len(st.scratch)
+}
+
+// appendQueryKey builds a query key from a key template like {} or filter[{}].
+// It returns false if any of the key placeholders is nil.
+func (st *formatState) appendQueryKey(q queryPart, args []any) (int, int, bool, error) {
+	k0 := len(st.scratch)
+	for _, p := range q.keyParts {
+		if p.partType == staticPart {
+			st.scratch = append(st.scratch, p.value...)
+			continue
+		}
+		arg, isDefault, err := resolveArg(st, p, "query", args[p.index])
+		if err != nil {
+			return 0, 0, false, err
+		}
+		if isDefault {
+			p.spec = nil
+		}
+		var ok bool
+		st.scratch, ok, err = st.appendValue(st.scratch, arg, p.spec)
+		if err != nil {
+			return 0, 0, false, newFormatError(p.index, "query", args[p.index], "query key of '%s': %v", q.key, err)
+		}
+		if !ok {
+			st.scratch = st.scratch[:k0]
+			return 0, 0, false, nil
+		}
+	}
+	return k0, len(st.scratch), true, nil
+}
+
+// addQuery adds a query value like url.Values.Add.
+func (st *formatState) addQuery(k0, k1 int, value string) {
+	v0 := len(st.scratch)
+	st.scratch = append(st.scratch, value...)
+	st.pairs = append(st.pairs, queryPair{k0: k0, k1: k1, v0: v0, v1: len(st.scratch)})
+}
+
+func (st *formatState) addQueryInt(k0, k1 int, value int) {
+	v0 := len(st.scratch)
+	st.scratch = strconv.AppendInt(st.scratch, int64(value), 10)
+	st.pairs = append(st.pairs, queryPair{k0: k0, k1: k1, v0: v0, v1: len(st.scratch)})
+}
+
+// deleteQuery removes values of the key. With addQuery, it works like url.Values.Set.
+func (st *formatState) deleteQuery(k0, k1 int) {
+	key := st.scratch[k0:k1]
+	pairs := st.pairs[:0]
+	for _, p := range st.pairs {
+		if !bytes.Equal(st.scratch[p.k0:p.k1], key) {
+			pairs = append(pairs, p)
+		}
+	}
+	st.pairs = pairs
+}
+
+// updateQueryArg adds the value of the query value placeholder.
+// With Opt.OmitDefaultQuery, the pair is removed if the value is the default.
+func (st *formatState) updateQueryArg(k0, k1 int, p part[string], args []any) error {
+	arg, isDefault, err := resolveArg(st, p, "query", args[p.index])
+	if err != nil {
+		return err
+	}
+	if isDefault {
+		p.spec = nil
+	}
+	n := len(st.pairs)
+	if err := st.updateQuery(k0, k1, p, arg); err != nil {
+		return err
+	}
+	if st.f.omitDefaultQuery && p.def != nil && len(st.pairs) == n+1 {
+		last := st.pairs[n]
+		def := *p.def
+		if last.escaped {
+			def = string(appendEscape(nil, def, encodeQueryComponent))
+		}
+		if string(st.scratch[last.v0:last.v1]) == def {
+			st.pairs = st.pairs[:n]
+		}
+	}
+	return nil
+}
+
+func (st *formatState) updateQuery(k0, k1 int, p part[string], value any) error {
+	style := p.style
+	if style == 0 {
+		style = st.f.arrayStyle
+	}
+	if style > ArrayRepeat {
+		if ok, err := st.updateQueryArray(k0, k1, p, style, value); ok {
+			return err
+		}
+	}
+	if p.spec == nil { // fast paths
+		switch v := value.(type) {
+		case string:
+			st.addQuery(k0, k1, v)
+			return nil
+		case []string:
+			st.updateQueryStrings(k0, k1, v)
+			return nil
+		case []int:
+			for i, ev := range v {
+				if i == 0 {
+					st.deleteQuery(k0, k1)
+				}
+				st.addQueryInt(k0, k1, ev)
+			}
+			return nil
+		}
+	}
+	if e, ok := st.encoder(value); ok {
+		if e.multi == nil {
+			return st.updateQueryElement(k0, k1, p, -1, value)
+		}
+		values, err := e.values(value)
+		if err != nil {
+			return newFormatError(p.index, "query", value, "%v", err)
+		}
+		st.updateQueryStrings(k0, k1, values)
+		return nil
+	}
+	switch v := value.(type) {
+	case nil:
+	case []string:
+		for i, ev := range v {
+			if err := st.updateQueryElement(k0, k1, p, i, ev); err != nil {
+				return elementError(err, i)
+			}
+		}
+	case []int:
+		for i, ev := range v {
+			if err := st.updateQueryElement(k0, k1, p, i, ev); err != nil {
+				return elementError(err, i)
+			}
+		}
+	case []any:
+		for i, ev := range v {
+			if err := st.updateQueryElement(k0, k1, p, i, ev); err != nil {
+				return elementError(err, i)
+			}
+		}
+	default:
+		// other slice types are rare and need reflection
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && !hasText(v) {
+			for i := 0; i < rv.Len(); i++ {
+				if err := st.updateQueryElement(k0, k1, p, i, rv.Index(i).Interface()); err != nil {
+					return elementError(err, i)
 				}
 			}
+			return nil
 		}
+		return st.updateQueryElement(k0, k1, p, -1, v)
+	}
+	return nil
+}
 
-		for _, p := range paths {
-			if strings.HasSuffix(r.Path, "/") && strings.HasPrefix(p, "/") {
-				r.Path = r.Path + p[1:]
-			} else {
-				r.Path += p
+// addQuerySet merges url.Values, QueryEncoder, a map or a struct into the query.
+// Maps and structs can be nested. See addQueryObject.
+func (st *formatState) addQuerySet(index int, v any) error {
+	var vs url.Values
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case url.Values:
+		vs = v
+	case QueryEncoder:
+		if isNilPointer(v) {
+			return nil
+		}
+		vs = v.URLQuery()
+	default:
+		if isNilPointer(v) {
+			return nil
+		}
+		if rv, ok := st.queryObject(v); ok {
+			err := st.addQueryObject(index, -1, -1, 0, rv)
+			var fe *FormatError
+			if errors.As(err, &fe) && fe.Value == nil { // the depth limit error is for the whole query set
+				fe.Value = v
 			}
+			return err
 		}
+		return newFormatError(index, "query", v, "query set must be url.Values, QueryEncoder, map or struct")
+	}
+	n := 0 // number of the added pairs
+	for key, values := range vs {
+		k0, k1 := st.appendKey(key)
+		st.updateQueryStrings(k0, k1, values)
+		n += len(values)
+	}
+	if st.f.preserveOrder {
+		st.sortPairs(st.pairs[len(st.pairs)-n:])
+	}
+	return nil
+}
 
-		if t.username != "" {
-			r.User = url.UserPassword(t.username, t.password)
+// updateQueryStrings works like url.Values.Set for the first value and url.Values.Add for the rest.
+func (st *formatState) updateQueryStrings(k0, k1 int, values []string) {
+	for i, v := range values {
+		if i == 0 {
+			st.deleteQuery(k0, k1)
 		}
+		st.addQuery(k0, k1, v)
+	}
+}
 
-		return r.String(), nil
+// updateQueryElement adds a scalar value. The first element (i == 0) of a slice overwrites the existing values.
+func (st *formatState) updateQueryElement(k0, k1 int, p part[string], i int, v any) error {
+	v0 := len(st.scratch)
+	var ok bool
+	var err error
+	st.scratch, ok, err = st.appendValue(st.scratch, v, p.spec)
+	if err != nil {
+		return newFormatError(p.index, "query", v, "%v", err)
+	}
+	if !ok {
+		return nil
+	}
+	if i == 0 {
+		st.deleteQuery(k0, k1)
+	}
+	st.pairs = append(st.pairs, queryPair{k0: k0, k1: k1, v0: v0, v1: len(st.scratch)})
+	return nil
+}
+
+// appendQuery writes the query in the same way as url.Values.Encode (sorted by key).
+// With Opt.PreserveQueryOrder, the pairs are written in the added order.
+func (st *formatState) appendQuery(dst []byte) []byte {
+	if len(st.pairs) == 0 {
+		return dst
+	}
+	if !st.f.preserveOrder {
+		st.sortPairs(st.pairs)
+	}
+	for i, p := range st.pairs {
+		if i == 0 {
+			dst = append(dst, '?')
+		} else {
+			dst = append(dst, '&')
+		}
+		dst = appendEscape(dst, st.scratch[p.k0:p.k1], encodeQueryComponent)
+		dst = append(dst, '=')
+		if p.escaped {
+			dst = append(dst, st.scratch[p.v0:p.v1]...)
+		} else {
+			dst = appendEscape(dst, st.scratch[p.v0:p.v1], encodeQueryComponent)
+		}
 	}
+	return dst
+}
+
+// sortPairs sorts the query pairs by key. Values of the same key keep their order.
+func (st *formatState) sortPairs(pairs []queryPair) {
+	slices.SortStableFunc(pairs, func(a, b queryPair) int {
+		return bytes.Compare(st.scratch[a.k0:a.k1], st.scratch[b.k0:b.k1])
+	})
 }
 
 // Urlf is a default formatter function.
@@ -270,38 +977,71 @@ func TryCustomFormatter(o Opt) func(format string, args ...any) (string, error)
 //
 // If you want to get parsing error, use TryUrlf, instead.
 func Urlf(format string, args ...any) string {
-	return CustomFormatter(Opt{})(format, args...)
+	if result, err := defaultFormatter.format(format, args); err != nil {
+		panic(mustError(format, err))
+	} else {
+		return result
+	}
 }
 
+var defaultFormatter = newFormatter(Opt{})
+
 // TryUrlf is a similar function to Urlf, but it returns an error if the format is invalid.
 func TryUrlf(format string, args ...any) (string, error) {
-	return TryCustomFormatter(Opt{})(format, args...)
+	return defaultFormatter.format(format, args)
 }
 
-var hostPattern = regexp.MustCompile(`^(?P<protocol>\w+:\/\/)?(?P<hostname>[^:]+)(?P<port>:\d+)?`)
+// splitHost splits Opt.Hostname like "https://localhost:8080" into protocol, hostname and port digits.
+func splitHost(s string) (protocol, hostname, port string) {
+	if i := strings.Index(s, "://"); i > 0 && isWord(s[:i]) {
+		protocol, s = s[:i], s[i+3:]
+	}
+	hostname, rest, found := strings.Cut(s, ":")
+	if found {
+		i := 0
+		for i < len(rest) && '0' <= rest[i] && rest[i] <= '9' {
+			i++
+		}
+		port = rest[:i]
+	}
+	return protocol, hostname, port
+}
 
-func overwrite(src *parseResult, opt Opt) (result *parseResult, err error) {
-	result = &parseResult{
-		protocol: src.protocol,
-		hostname: src.hostname,
-		port:     src.port,
-		paths:    src.paths,
-		queries:  src.queries,
-		fragment: src.fragment,
+func isWord(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_') {
+			return false
+		}
 	}
+	return true
+}
+
+// overrides is the parts of URL that are overwritten by Opt. It is computed once per formatter.
+type overrides struct {
+	protocol *part[string]
+	hostname *part[string]
+	port     *part[uint16]
+	userinfo bool // username and password are overwritten (or omitted if they are nil)
+	username *part[string]
+	password *part[string]
+}
+
+func newOverrides(opt Opt) (result *overrides, err error) {
+	result = &overrides{}
 
 	if opt.Hostname != "" {
-		match := hostPattern.FindStringSubmatch(opt.Hostname)
-		if match[1] != "" {
-			result.protocol = &part[string]{partType: staticPart, value: match[1][:len(match[1])-3]}
+		protocol, hostname, port := splitHost(opt.Hostname)
+		if protocol != "" {
+			result.protocol = &part[string]{partType: staticPart, value: protocol}
 		}
-		if match[2] != "" {
-			result.hostname = &part[string]{partType: staticPart, value: match[2]}
+		if hostname != "" {
+			result.hostname = &part[string]{partType: staticPart, value: hostname}
 		}
-		if match[3] != "" {
-			p, err := strconv.ParseUint(match[3][1:], 10, 16)
+		if port != "" {
+			p, err := strconv.ParseUint(port, 10, 16)
 			if err != nil {
-				return nil, fmt.Errorf("%w: invalid port number '%s'", ErrParseFailed, match[3])
+				return nil, fmt.Errorf("%w: invalid port number ':%s'", ErrParseFailed, port)
 			}
 			result.port = &part[uint16]{partType: staticPart, value: uint16(p)}
 		}
@@ -312,11 +1052,45 @@ func overwrite(src *parseResult, opt Opt) (result *parseResult, err error) {
 	if opt.Port != 0 {
 		result.port = &part[uint16]{partType: staticPart, value: opt.Port}
 	}
-	if opt.Username != "" && opt.Password != "" {
-		result.username = opt.Username
-		result.password = opt.Password
-	} else if opt.Username != "" || opt.Password != "" {
-		return nil, fmt.Errorf("%w: both username and password must be set", ErrParseFailed)
+	switch {
+	case opt.OmitUserinfo:
+		result.userinfo = true
+	case opt.Userinfo != nil:
+		if opt.Username != "" || opt.Password != "" {
+			return nil, fmt.Errorf("%w: Userinfo and Username/Password can't be used at the same time", ErrParseFailed)
+		}
+		result.userinfo = true
+		result.username = &part[string]{partType: staticPart, value: opt.Userinfo.Username()}
+		if p, ok := opt.Userinfo.Password(); ok {
+			result.password = &part[string]{partType: staticPart, value: p}
+		}
+	case opt.Username != "":
+		result.userinfo = true
+		result.username = &part[string]{partType: staticPart, value: opt.Username}
+		if opt.Password != "" {
+			result.password = &part[string]{partType: staticPart, value: opt.Password}
+		}
+	case opt.Password != "":
+		return nil, fmt.Errorf("%w: username must be set with password", ErrParseFailed)
 	}
 	return result, nil
 }
+
+// apply returns a copy of the template whose parts are overwritten.
+func (o *overrides) apply(src *parseResult) parseResult {
+	result := *src
+	if o.protocol != nil {
+		result.protocol = o.protocol
+	}
+	if o.hostname != nil {
+		result.hostname = o.hostname
+	}
+	if o.port != nil {
+		result.port = o.port
+	}
+	if o.userinfo {
+		result.username = o.username
+		result.password = o.password
+	}
+	return result
+}
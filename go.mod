@@ -2,8 +2,9 @@ module github.com/shibukawa/urlf
 
 go 1.23.1
 
+require github.com/alecthomas/assert/v2 v2.11.0
+
 require (
-	github.com/alecthomas/assert/v2 v2.11.0 // indirect
 	github.com/alecthomas/repr v0.4.0 // indirect
 	github.com/globusdigital/deep-copy v0.5.4 // indirect
 	github.com/hexops/gotextdiff v1.0.3 // indirect
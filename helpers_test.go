@@ -0,0 +1,54 @@
+package urlf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// formatCase is a table test case of formatting the template with the options.
+type formatCase struct {
+	name   string
+	opt    Opt
+	format string
+	args   []any
+	want   string
+}
+
+// testFormat checks the URLs formatted by TryCustomFormatter.
+func testFormat(t *testing.T, tests []formatCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TryCustomFormatter(tt.opt)(tt.format, tt.args...)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// formatErrorCase is a table test case of FormatError.
+type formatErrorCase struct {
+	name    string
+	format  string
+	args    []any
+	wantMsg string // FormatError.Reason
+}
+
+// testFormatError checks the reasons of FormatError returned by TryUrlf.
+func testFormatError(t *testing.T, tests []formatErrorCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := TryUrlf(tt.format, tt.args...)
+			var fe *FormatError
+			assert.True(t, errors.As(err, &fe))
+			assert.Equal(t, tt.wantMsg, fe.Reason)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package urlf
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Call is a formatting call passed to middlewares.
+type Call struct {
+	Template string
+	Args     []any
+
+	// parsed is the template parsed by Formatter.Format. It is used only if Template is still the same.
+	parsed         *parseResult
+	parsedTemplate string
+}
+
+// FormatFunc builds the URL of the call.
+type FormatFunc func(c *Call) (*url.URL, error)
+
+// Middleware wraps FormatFunc to add cross-cutting behavior like tracking parameters, audit logs and policies.
+//
+// Middlewares can change the call before calling next and the URL after it.
+// The URL is signed by Opt.Signer after all middlewares run.
+type Middleware func(next FormatFunc) FormatFunc
+
+// Hook returns a Middleware that calls fn after each formatting with the result and the elapsed time.
+func Hook(fn func(c *Call, u *url.URL, err error, elapsed time.Duration)) Middleware {
+	return func(next FormatFunc) FormatFunc {
+		return func(c *Call) (*url.URL, error) {
+			start := time.Now()
+			u, err := next(c)
+			fn(c, u, err, time.Since(start))
+			return u, err
+		}
+	}
+}
+
+// Use adds middlewares. The first middleware is the outermost one.
+//
+// It is not safe to call Use while formatting URLs.
+func (f *Formatter) Use(mw ...Middleware) {
+	f.f.use(mw)
+}
+
+func (f *formatter) use(mw []Middleware) {
+	f.middlewares = append(f.middlewares, mw...)
+	f.handler = nil
+	if len(f.middlewares) == 0 {
+		return
+	}
+	h := f.build
+	for i := len(f.middlewares) - 1; i >= 0; i-- {
+		h = f.middlewares[i](h)
+	}
+	f.handler = h
+}
+
+// build is the innermost FormatFunc of middlewares.
+func (f *formatter) build(c *Call) (*url.URL, error) {
+	st := statePool.Get().(*formatState)
+	defer st.release()
+	ot := c.parsed
+	if ot != nil && c.parsedTemplate != c.Template { // the middleware changed the template
+		ot = nil
+	}
+	var err error
+	st.out, err = f.appendTemplate(st.out[:0], c.Template, ot, c.Args)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(string(st.out))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFormatFailed, err)
+	}
+	return u, nil
+}
@@ -0,0 +1,141 @@
+package urlf
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func addQuery(key, value string) Middleware {
+	return func(next FormatFunc) FormatFunc {
+		return func(c *Call) (*url.URL, error) {
+			u, err := next(c)
+			if err != nil {
+				return nil, err
+			}
+			q := u.Query()
+			q.Set(key, value)
+			u.RawQuery = q.Encode()
+			return u, nil
+		}
+	}
+}
+
+var errInsecure = errors.New("insecure URL")
+
+func requireHTTPS(next FormatFunc) FormatFunc {
+	return func(c *Call) (*url.URL, error) {
+		u, err := next(c)
+		if err == nil && u.Scheme != "https" {
+			return nil, errInsecure
+		}
+		return u, err
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		opt     Opt
+		format  string
+		args    []any
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "tracking parameter",
+			opt:    Opt{Middlewares: []Middleware{addQuery("utm_source", "newsletter")}},
+			format: "https://example.com/items/{}?page={}",
+			args:   []any{10, 2},
+			want:   "https://example.com/items/10?page=2&utm_source=newsletter",
+		},
+		{
+			name:   "order",
+			opt:    Opt{Middlewares: []Middleware{addQuery("a", "outer"), addQuery("a", "inner")}},
+			format: "https://example.com/",
+			want:   "https://example.com/?a=outer",
+		},
+		{
+			name:   "with overrides",
+			opt:    Opt{Hostname: "http://localhost:8080", Middlewares: []Middleware{addQuery("debug", "1")}},
+			format: "https://api-server/users/{}",
+			args:   []any{1},
+			want:   "http://localhost:8080/users/1?debug=1",
+		},
+		{
+			name:    "policy",
+			opt:     Opt{Middlewares: []Middleware{requireHTTPS}},
+			format:  "http://example.com/",
+			wantErr: errInsecure,
+		},
+		{
+			name:    "format error",
+			opt:     Opt{Middlewares: []Middleware{requireHTTPS}},
+			format:  "https://example.com:{}/",
+			args:    []any{"abc"},
+			wantErr: ErrFormatFailed,
+		},
+		{
+			name: "change arguments",
+			opt: Opt{Middlewares: []Middleware{func(next FormatFunc) FormatFunc {
+				return func(c *Call) (*url.URL, error) {
+					c.Args = append([]any{"v2"}, c.Args...)
+					c.Template = "https://example.com/{}/" + strings.TrimPrefix(c.Template, "https://example.com/")
+					return next(c)
+				}
+			}}},
+			format: "https://example.com/users/{}",
+			args:   []any{1},
+			want:   "https://example.com/v2/users/1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TryCustomFormatter(tt.opt)(tt.format, tt.args...)
+			if tt.wantErr != nil {
+				assert.IsError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFormatterUse(t *testing.T) {
+	var calls []string
+	var errs int
+	f := NewFormatter(Opt{Signer: &HMACSigner{Key: []byte("secret")}})
+	f.Use(addQuery("utm_source", "mail"), Hook(func(c *Call, u *url.URL, err error, elapsed time.Duration) {
+		assert.True(t, elapsed >= 0)
+		if err != nil {
+			errs++
+			return
+		}
+		calls = append(calls, c.Template+" "+u.String())
+	}))
+
+	r, err := f.Format("https://example.com/files/{}", "a.txt")
+	assert.NoError(t, err)
+	u, err := r.URL()
+	assert.NoError(t, err)
+	assert.Equal(t, "mail", u.Query().Get("utm_source"))
+	assert.NoError(t, (&HMACSigner{Key: []byte("secret")}).Verify(u))
+
+	_, err = f.Format("https://example.com:{}/", "abc")
+	assert.IsError(t, err, ErrFormatFailed)
+
+	buf, err := f.AppendURL([]byte("url: "), "https://example.com/{}", "b")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(buf), "url: https://example.com/b?utm_source=mail&signature="))
+
+	assert.Equal(t, []string{
+		"https://example.com/files/{} https://example.com/files/a.txt",
+		"https://example.com/{} https://example.com/b",
+	}, calls)
+	assert.Equal(t, 1, errs)
+}
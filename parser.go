@@ -2,9 +2,9 @@ package urlf
 
 import (
 	"errors"
-	"fmt"
-	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 )
 
 var ErrParseFailed = errors.New("parse failed")
@@ -14,17 +14,30 @@ type partType int
 const (
 	staticPart partType = iota + 1
 	paramPart
+	optionalStart // '[' of the optional path section like [/{}]
+	optionalEnd   // ']' of the optional path section
 )
 
 type part[T comparable] struct {
 	partType partType
 	index    int
 	value    T
+	format   string      // format spec of the placeholder like "05d" of {:05d}
+	spec     *formatSpec // parsed format
+	required bool        // {!}
+	def      *string     // default value of {=value}
+	style    ArrayStyle  // array style of the query value like {,}. 0 means Opt.ArrayStyle
+}
+
+// newParam creates a placeholder part from the token.
+func newParam[T comparable](t token) *part[T] {
+	return &part[T]{partType: paramPart, index: t.index, format: t.format, spec: t.spec, required: t.required, def: t.def, style: t.style}
 }
 
 type queryPart struct {
-	key   string
-	value part[string]
+	key      string
+	keyParts []part[string] // non-nil when the key contains placeholders like {}={} or filter[{}]={}
+	value    part[string]
 }
 
 type parseResult struct {
@@ -34,8 +47,8 @@ type parseResult struct {
 	paths    []part[string]
 	queries  []queryPart
 	fragment *part[string]
-	username string
-	password string
+	username *part[string]
+	password *part[string]
 }
 
 type stepType int
@@ -60,8 +73,6 @@ var invalidSeparator = map[stepType]map[string]bool{
 	queryValue: {"://": true, "//": true, ":": true, "/": true, "?": true, "=": true, "&": false, "#": false, "@": true},
 }
 
-var splitterPattern = regexp.MustCompile(`(?::\/\/)|(?:\/\/)|[:/?&=#@]|\{\}`)
-
 type tokenType int
 
 const (
@@ -74,30 +85,110 @@ type token struct {
 	tokenType tokenType
 	text      string
 	index     int
+	offset    int         // byte offset in the template
+	format    string      // format spec of the placeholder
+	spec      *formatSpec // parsed format. It is set by parse
+	required  bool
+	def       *string
+	style     ArrayStyle
 }
 
-func parse(pattern string) (result *parseResult, err error) {
-	result = &parseResult{}
-
-	i := 0
+// scan splits the template into separators (://, //, :, /, ?, &, =, #, @),
+// placeholders ({}, {:format}, {!}, {?} or {=default} with an optional array style and format) and static strings.
+func scan(pattern string) []token {
+	tokens := make([]token, 0, 16)
 	placeholderIndex := 0
-	matches := splitterPattern.FindAllStringIndex(pattern, -1)
-	tokens := make([]token, 0, len(matches)*2+1)
-	for _, m := range matches {
-		if i < m[0] {
-			tokens = append(tokens, token{tokenType: static, text: pattern[i:m[0]]})
-		}
-		s := pattern[m[0]:m[1]]
-		if s == "{}" {
-			tokens = append(tokens, token{tokenType: placeholder, index: placeholderIndex})
+	start := 0 // start of the current static string
+	for i := 0; i < len(pattern); {
+		var t token
+		switch c := pattern[i]; {
+		case c == ':' && strings.HasPrefix(pattern[i:], "://"):
+			t = token{tokenType: separator, text: pattern[i : i+3]}
+		case c == '/' && strings.HasPrefix(pattern[i:], "//"):
+			t = token{tokenType: separator, text: pattern[i : i+2]}
+		case c == ':' || c == '/' || c == '?' || c == '&' || c == '=' || c == '#' || c == '@':
+			t = token{tokenType: separator, text: pattern[i : i+1]}
+		case c == '{' && placeholderEnd(pattern[i:]) > 0:
+			t = token{tokenType: placeholder, index: placeholderIndex, text: pattern[i : i+placeholderEnd(pattern[i:])]}
+			t.parseMarker()
 			placeholderIndex++
-		} else {
-			tokens = append(tokens, token{tokenType: separator, text: s})
+		default:
+			i++
+			continue
+		}
+		if start < i {
+			tokens = append(tokens, token{tokenType: static, text: pattern[start:i], offset: start})
+		}
+		t.offset = i
+		i += len(t.text)
+		if t.tokenType == placeholder {
+			t.text = ""
+		}
+		tokens = append(tokens, t)
+		start = i
+	}
+	if start < len(pattern) {
+		tokens = append(tokens, token{tokenType: static, text: pattern[start:], offset: start})
+	}
+	return tokens
+}
+
+// placeholderEnd returns the length of the placeholder at the beginning of s, or 0 if s doesn't start with it.
+func placeholderEnd(s string) int {
+	if len(s) < 2 || s[0] != '{' {
+		return 0
+	}
+	end := strings.IndexByte(s, '}')
+	if end < 0 {
+		return 0
+	}
+	switch _, body := cutArrayStyle(s[1:end]); {
+	case body == "", body[0] == ':', body[0] == '=':
+		return end + 1
+	case body[0] == '!' || body[0] == '?':
+		if len(body) == 1 || body[1] == ':' {
+			return end + 1
 		}
-		i = m[1]
 	}
-	if i < len(pattern) {
-		tokens = append(tokens, token{tokenType: static, text: pattern[i:]})
+	return 0
+}
+
+// parseMarker reads the markers and the format of the placeholder text like {!:05d}, {=10} or {,!}.
+// The array style comes first and the default value of {=value} ends at the first ':'.
+func (t *token) parseMarker() {
+	var body string
+	t.style, body = cutArrayStyle(t.text[1 : len(t.text)-1])
+	if body == "" {
+		return
+	}
+	switch body[0] {
+	case '!':
+		t.required = true
+		body = body[1:]
+	case '?':
+		body = body[1:]
+	case '=':
+		def, format, _ := strings.Cut(body[1:], ":")
+		t.def = &def
+		t.format = format
+		return
+	}
+	t.format = strings.TrimPrefix(body, ":")
+}
+
+func parse(pattern string) (result *parseResult, err error) {
+	result = &parseResult{}
+
+	tokens := scan(pattern)
+	scanned := tokens // tokens is consumed by the steps below
+	for i, t := range tokens {
+		if t.format != "" {
+			spec, err := parseSpec(t.format)
+			if err != nil {
+				return nil, newParseError(pattern, t.offset, "placeholder", "%v", err)
+			}
+			tokens[i].spec = spec
+		}
 	}
 
 	appendPath := func(pathString string) {
@@ -113,9 +204,46 @@ func parse(pattern string) (result *parseResult, err error) {
 		}
 	}
 
+	var sections []int // offsets of ']' that close the open optional path sections
+	// appendPathText appends a static path text and splits the optional path sections.
+	// Brackets that enclose no placeholder are kept as static text like /items[1].
+	appendPathText := func(text string, offset int) error {
+		start := 0
+		for i := 0; i < len(text); i++ {
+			var pt partType
+			switch {
+			case text[i] == '[':
+				end, ok := matchSection(scanned, offset+i)
+				if !ok {
+					continue
+				}
+				if end < 0 {
+					return newParseError(pattern, offset+i, "path", "'[' is not closed")
+				}
+				sections = append(sections, end)
+				pt = optionalStart
+			case text[i] == ']' && len(sections) > 0 && sections[len(sections)-1] == offset+i:
+				sections = sections[:len(sections)-1]
+				pt = optionalEnd
+			default:
+				continue
+			}
+			if i > start {
+				appendPath(text[start:i])
+			}
+			result.paths = append(result.paths, part[string]{partType: pt, value: text[i : i+1]})
+			start = i + 1
+		}
+		if start < len(text) {
+			appendPath(text[start:])
+		}
+		return nil
+	}
+
 	var lastToken string
 	step := protocol
 	var queryKeyStr string
+	var queryKeyParts []part[string]
 
 	for len(tokens) > 0 {
 		switch step {
@@ -126,9 +254,12 @@ func parse(pattern string) (result *parseResult, err error) {
 					s := tokens[1] // separator
 					if s.tokenType == separator && s.text == "://" {
 						if p.tokenType == placeholder {
-							result.protocol = &part[string]{partType: paramPart, index: p.index}
+							if err := noFormat(pattern, p, "protocol"); err != nil {
+								return nil, err
+							}
+							result.protocol = newParam[string](p)
 						} else if p.tokenType == static && p.text == "" {
-							return nil, fmt.Errorf("%w: protocol name should not be empty", ErrParseFailed)
+							return nil, newParseError(pattern, p.offset, "protocol", "protocol name should not be empty")
 						} else {
 							result.protocol = &part[string]{partType: staticPart, value: p.text}
 						}
@@ -139,7 +270,7 @@ func parse(pattern string) (result *parseResult, err error) {
 					}
 					if p.tokenType == separator {
 						if invalidSeparator[protocol][p.text] {
-							return nil, fmt.Errorf("%w: invalid character: '%s'. only protocol name or //, / are available", ErrParseFailed, p.text)
+							return nil, newParseError(pattern, p.offset, "protocol", "invalid character '%s'. only protocol name, '//' or '/' is available", p.text)
 						}
 						if p.text == "//" {
 							// Scheme relative URL
@@ -152,17 +283,32 @@ func parse(pattern string) (result *parseResult, err error) {
 					} else {
 						step = path
 					}
+				} else {
+					step = path
 				}
 				break
 			}
 		case hostname:
 			{
+				if at := userinfoEnd(tokens); at >= 0 {
+					if err := parseUserinfo(pattern, result, tokens[:at+1]); err != nil {
+						return nil, err
+					}
+					tokens = tokens[at+1:]
+					if len(tokens) == 0 {
+						return nil, newParseError(pattern, len(pattern), "hostname", "hostname is expected after '@'")
+					}
+					lastToken = "@"
+				}
 				h := tokens[0] // hostname
 				if h.tokenType == separator {
-					return nil, fmt.Errorf("%w: invalid character: '%s'. after '%s' only hostname string is expected", ErrParseFailed, h.text, lastToken)
+					return nil, newParseError(pattern, h.offset, "hostname", "invalid character '%s' after '%s'. only hostname is expected", h.text, lastToken)
 				}
 				if h.tokenType == placeholder {
-					result.hostname = &part[string]{partType: paramPart, index: h.index}
+					if err := noFormat(pattern, h, "hostname"); err != nil {
+						return nil, err
+					}
+					result.hostname = newParam[string](h)
 				} else {
 					result.hostname = &part[string]{partType: staticPart, value: h.text}
 				}
@@ -179,23 +325,31 @@ func parse(pattern string) (result *parseResult, err error) {
 						p := tokens[1] // port
 						switch p.tokenType {
 						case separator:
-							return nil, fmt.Errorf("%w: invalid character: '%s'. after ':' only port number is expected", ErrParseFailed, p.text)
+							return nil, newParseError(pattern, p.offset, "port", "invalid character '%s' after ':'. only port number is expected", p.text)
 						case placeholder:
-							result.port = &part[uint16]{partType: paramPart, index: p.index}
+							if err := noFormat(pattern, p, "port"); err != nil {
+								return nil, err
+							}
+							if p.def != nil {
+								if pn, err := strconv.Atoi(*p.def); err != nil || pn < 0 || pn > 65535 {
+									return nil, newParseError(pattern, p.offset, "port", "default port must be a number in range 0-65535, but '%s'", *p.def)
+								}
+							}
+							result.port = newParam[uint16](p)
 						case static:
 							pn, err := strconv.Atoi(p.text)
 							if err != nil {
-								return nil, fmt.Errorf("%w: port must be a number, but '%s'", ErrParseFailed, p.text)
+								return nil, newParseError(pattern, p.offset, "port", "port must be a number, but '%s'", p.text)
 							}
 							if pn < 1 || pn > 65535 {
-								return nil, fmt.Errorf("%w: port number must be in range 1-65535, but %d", ErrParseFailed, pn)
+								return nil, newParseError(pattern, p.offset, "port", "port number must be in range 1-65535, but %d", pn)
 							}
 							result.port = &part[uint16]{partType: staticPart, value: uint16(pn)}
 						}
 						lastToken = "port"
 						tokens = tokens[2:]
 					} else {
-						return nil, fmt.Errorf("%w: port number is expected after ':'", ErrParseFailed)
+						return nil, newParseError(pattern, len(pattern), "port", "port number is expected after ':'")
 					}
 				}
 				step = path
@@ -206,17 +360,26 @@ func parse(pattern string) (result *parseResult, err error) {
 				s := tokens[0] // separator
 				switch s.tokenType {
 				case placeholder:
-					return nil, fmt.Errorf("%w: invalid placeholder after %s", ErrParseFailed, lastToken)
+					// optional sections can have a prefix before the placeholder like [/v{}]
+					if len(sections) == 0 || lastToken == "{}" {
+						return nil, newParseError(pattern, s.offset, "path", "invalid placeholder. path placeholder should be placed after '/'")
+					}
+					result.paths = append(result.paths, *newParam[string](s))
+					tokens = tokens[1:]
+					lastToken = "{}"
 				case static:
 					// if input is relative path like "./path/to/resource" or "path/to/resource", it is ok.
 					if (result.protocol != nil || result.hostname != nil) && len(result.paths) == 0 {
-						return nil, fmt.Errorf("%w: invalid text after '%s': '%s'", ErrParseFailed, lastToken, s.text)
+						return nil, newParseError(pattern, s.offset, "path", "invalid text '%s' after '%s'", s.text, lastToken)
+					}
+					if err := appendPathText(s.text, s.offset); err != nil {
+						return nil, err
 					}
-					appendPath(s.text)
+					lastToken = s.text
 					tokens = tokens[1:]
 				case separator:
 					if invalidSeparator[path][s.text] {
-						return nil, fmt.Errorf("%w: invalid character after %s: '/', '?', '#' are available but '%s'", ErrParseFailed, lastToken, s.text)
+						return nil, newParseError(pattern, s.offset, "path", "invalid character '%s' after '%s'. only '/', '?', '#' are available", s.text, lastToken)
 					}
 					if s.text != "/" {
 						step = query
@@ -230,12 +393,14 @@ func parse(pattern string) (result *parseResult, err error) {
 							tokens = tokens[1:]
 						case placeholder:
 							appendPath("/")
-							result.paths = append(result.paths, part[string]{partType: paramPart, index: p.index})
+							result.paths = append(result.paths, *newParam[string](p))
 							tokens = tokens[2:]
-							lastToken = fmt.Sprintf("{%d}", p.index)
+							lastToken = "{}"
 						case static:
 							lastToken = "/" + p.text
-							appendPath(lastToken)
+							if err := appendPathText(lastToken, s.offset); err != nil {
+								return nil, err
+							}
 							tokens = tokens[2:]
 						}
 					} else {
@@ -252,7 +417,7 @@ func parse(pattern string) (result *parseResult, err error) {
 				switch s.tokenType {
 				case separator:
 					if invalidSeparator[query][s.text] {
-						return nil, fmt.Errorf("%w: invalid character after %s should be '?', '=', '&', '#' but '%s'", ErrParseFailed, lastToken, s.text)
+						return nil, newParseError(pattern, s.offset, "query", "invalid character '%s' after '%s'. only '?', '#' are available", s.text, lastToken)
 					}
 					switch s.text {
 					case "?":
@@ -263,26 +428,65 @@ func parse(pattern string) (result *parseResult, err error) {
 					}
 					tokens = tokens[1:]
 				case placeholder:
-					return nil, fmt.Errorf("%w: invalid placeholder {%d} after %s. It should be '?' or '#'", ErrParseFailed, s.index, lastToken)
+					return nil, newParseError(pattern, s.offset, "query", "invalid placeholder after '%s'. only '?', '#' are available", lastToken)
 				case static:
-					return nil, fmt.Errorf("%w: invalid character after %s should be '?', '#' but '%s'", ErrParseFailed, lastToken, s.text)
+					return nil, newParseError(pattern, s.offset, "query", "invalid text '%s' after '%s'. only '?', '#' are available", s.text, lastToken)
 				}
 			}
 		case queryKey:
 			{
+				// key text can be a mix of static strings and placeholders like filter[{}]
+				n := 0
+				hasPlaceholder := false
+				keyStr := ""
+				for n < len(tokens) && tokens[n].tokenType != separator {
+					if tokens[n].tokenType == placeholder {
+						hasPlaceholder = true
+						keyStr += "{}"
+					} else {
+						keyStr += tokens[n].text
+					}
+					n++
+				}
+				if n == 0 {
+					return nil, newParseError(pattern, tokens[0].offset, "query", "query key should be a string or placeholder, but '%s'", tokens[0].text)
+				}
+				if hasPlaceholder && n < len(tokens) && tokens[n].text == "=" { // dynamic key
+					queryKeyParts = make([]part[string], 0, n)
+					for _, t := range tokens[:n] {
+						if t.tokenType == placeholder {
+							queryKeyParts = append(queryKeyParts, *newParam[string](t))
+						} else {
+							queryKeyParts = append(queryKeyParts, part[string]{partType: staticPart, value: t.text})
+						}
+					}
+					queryKeyStr = keyStr
+					lastToken = keyStr
+					step = queryValue
+					tokens = tokens[n+1:]
+					break
+				}
+				if n > 1 {
+					return nil, newParseError(pattern, tokens[0].offset, "query", "query key '%s' with placeholder should be followed by '='", keyStr)
+				}
 				qk := tokens[0] // query key
+				queryKeyParts = nil
 				switch qk.tokenType {
-				case separator:
-					return nil, fmt.Errorf("%w: query key should be a string or placeholder, but  '%s'", ErrParseFailed, qk.text)
 				case placeholder: // query set
+					if err := noFormat(pattern, qk, "query"); err != nil {
+						return nil, err
+					}
+					if qk.def != nil {
+						return nil, newParseError(pattern, qk.offset, "query", "default value is not available for query set placeholder")
+					}
 					if len(tokens) > 1 {
 						s := tokens[1] // splitter
 						switch s.tokenType {
 						case static:
-							return nil, fmt.Errorf("%w: invalid character after query set placeholder {%d}. Only &, # are available, but '%s'", ErrParseFailed, qk.index, s.text)
+							return nil, newParseError(pattern, s.offset, "query", "invalid text '%s' after query set placeholder. only '&', '#' are available", s.text)
 						case separator:
 							if invalidSeparator[queryValue][s.text] {
-								return nil, fmt.Errorf("%w: invalid character after query set placeholder {%d}. only &, # are available but '%s'", ErrParseFailed, qk.index, s.text)
+								return nil, newParseError(pattern, s.offset, "query", "invalid character '%s' after query set placeholder. only '&', '#' are available", s.text)
 							}
 							if s.text == "#" {
 								step = fragment
@@ -294,13 +498,13 @@ func parse(pattern string) (result *parseResult, err error) {
 						step = invalid
 						tokens = tokens[1:]
 					}
-					result.queries = append(result.queries, queryPart{key: "", value: part[string]{partType: paramPart, index: qk.index}})
+					result.queries = append(result.queries, queryPart{key: "", value: *newParam[string](qk)})
 				case static:
 					if len(tokens) > 1 {
 						s := tokens[1] // splitter
 						if s.tokenType == separator {
 							if invalidSeparator[queryKey][s.text] {
-								return nil, fmt.Errorf("%w: invalid character after query key '%s'. only =, &, # are available but '%s'", ErrParseFailed, qk.text, s.text)
+								return nil, newParseError(pattern, s.offset, "query", "invalid character '%s' after query key '%s'. only '=', '&', '#' are available", s.text, qk.text)
 							}
 							switch s.text {
 							case "=":
@@ -317,6 +521,7 @@ func parse(pattern string) (result *parseResult, err error) {
 						}
 					} else {
 						result.queries = append(result.queries, queryPart{key: qk.text, value: part[string]{partType: staticPart, value: ""}})
+						tokens = tokens[1:]
 					}
 				}
 			}
@@ -325,22 +530,22 @@ func parse(pattern string) (result *parseResult, err error) {
 				qv := tokens[0] // query value
 				switch qv.tokenType {
 				case separator:
-					return nil, fmt.Errorf("%w: query value of '%s' should be a string or placeholder, but '%s'", ErrParseFailed, queryKeyStr, qv.text)
+					return nil, newParseError(pattern, qv.offset, "query", "query value of '%s' should be a string or placeholder, but '%s'", queryKeyStr, qv.text)
 				case placeholder:
-					result.queries = append(result.queries, queryPart{key: queryKeyStr, value: part[string]{partType: paramPart, index: qv.index}})
+					result.queries = append(result.queries, queryPart{key: queryKeyStr, keyParts: queryKeyParts, value: *newParam[string](qv)})
 				case static:
-					result.queries = append(result.queries, queryPart{key: queryKeyStr, value: part[string]{partType: staticPart, value: qv.text}})
+					result.queries = append(result.queries, queryPart{key: queryKeyStr, keyParts: queryKeyParts, value: part[string]{partType: staticPart, value: qv.text}})
 				}
 				if len(tokens) > 1 {
 					s := tokens[1] // splitter
 					switch s.tokenType {
 					case placeholder:
-						return nil, fmt.Errorf("%w: invalid placeholder {%d} after query value of '%s'", ErrParseFailed, s.index, queryKeyStr)
+						return nil, newParseError(pattern, s.offset, "query", "invalid placeholder after query value of '%s'", queryKeyStr)
 					case static:
-						return nil, fmt.Errorf("%w: invalid text '%s' after query value of '%s'", ErrParseFailed, s.text, queryKeyStr)
+						return nil, newParseError(pattern, s.offset, "query", "invalid text '%s' after query value of '%s'", s.text, queryKeyStr)
 					case separator:
 						if invalidSeparator[queryValue][s.text] {
-							return nil, fmt.Errorf("%w: invalid character after query value of '%s'. only &, # are available but '%s", ErrParseFailed, queryKeyStr, s.text)
+							return nil, newParseError(pattern, s.offset, "query", "invalid character '%s' after query value of '%s'. only '&', '#' are available", s.text, queryKeyStr)
 						}
 						switch s.text {
 						case "&":
@@ -359,19 +564,132 @@ func parse(pattern string) (result *parseResult, err error) {
 				f := tokens[0] // fragment
 				switch f.tokenType {
 				case separator:
-					return nil, fmt.Errorf("%w: invalid character after fragment. A static string or placeholder are available but '%s'", ErrParseFailed, f.text)
+					return nil, newParseError(pattern, f.offset, "fragment", "invalid character '%s' in fragment. only a static string or placeholder is available", f.text)
 				case static:
 					result.fragment = &part[string]{partType: staticPart, value: f.text}
 				case placeholder:
-					result.fragment = &part[string]{partType: paramPart, index: f.index}
+					result.fragment = newParam[string](f)
 				}
 				tokens = tokens[1:]
 				step = invalid // this should be the last step
 			}
 		case invalid:
-			return nil, fmt.Errorf("%w: the url have invalid extra token: [%v]", ErrParseFailed, tokens)
+			return nil, newParseError(pattern, tokens[0].offset, "fragment", "unexpected text '%s' after fragment", pattern[tokens[0].offset:])
 		}
 	}
 
+	if err := checkArrayStyles(pattern, scanned, result); err != nil {
+		return nil, err
+	}
 	return result, nil
 }
+
+// checkArrayStyles returns an error if a placeholder other than query values has an array style.
+func checkArrayStyles(pattern string, tokens []token, result *parseResult) error {
+	for _, t := range tokens {
+		if t.tokenType != placeholder || t.style == 0 {
+			continue
+		}
+		if !slices.ContainsFunc(result.queries, func(q queryPart) bool {
+			return q.key != "" && q.value.partType == paramPart && q.value.index == t.index
+		}) {
+			return newParseError(pattern, t.offset, "placeholder", "array style '%s' is available only for query value placeholder", arrayMarker(t.style))
+		}
+	}
+	return nil
+}
+
+// matchSection finds the ']' that closes the '[' at offset in the path. ok is false if no placeholder follows
+// the '[' in the path, and the brackets are static text then. end is -1 if the section is not closed.
+func matchSection(tokens []token, offset int) (end int, ok bool) {
+	depth := 0
+	for _, t := range tokens {
+		if t.offset < offset && (t.tokenType != static || t.offset+len(t.text) <= offset) {
+			continue
+		}
+		switch t.tokenType {
+		case placeholder:
+			ok = true
+		case separator:
+			if t.text != "/" { // end of the path
+				return -1, ok
+			}
+		case static:
+			for i := max(offset-t.offset, 0); i < len(t.text); i++ {
+				switch t.text[i] {
+				case '[':
+					depth++
+				case ']':
+					depth--
+					if depth == 0 {
+						return t.offset + i, ok
+					}
+				}
+			}
+		}
+	}
+	return -1, ok
+}
+
+// noFormat returns an error if the placeholder in the part that doesn't support format specs has it.
+func noFormat(pattern string, t token, part string) error {
+	if t.tokenType == placeholder && t.format != "" {
+		name := part
+		if part == "query" {
+			name = "query set"
+		}
+		return newParseError(pattern, t.offset, part, "format spec ':%s' is not available for %s placeholder", t.format, name)
+	}
+	return nil
+}
+
+// userinfoEnd returns the position of '@' that ends userinfo like {}:{}@.
+// It returns -1 if there is no '@' before the path, query or fragment.
+func userinfoEnd(tokens []token) int {
+	for i, t := range tokens {
+		if t.tokenType != separator {
+			continue
+		}
+		switch t.text {
+		case "@":
+			return i
+		case "/", "//", "://", "?", "#":
+			return -1
+		}
+	}
+	return -1
+}
+
+// parseUserinfo parses tokens of user@, user:password@ or user:@ (empty password).
+func parseUserinfo(pattern string, result *parseResult, tokens []token) error {
+	toPart := func(t token) *part[string] {
+		if t.tokenType == placeholder {
+			return newParam[string](t)
+		}
+		return &part[string]{partType: staticPart, value: t.text}
+	}
+	at := tokens[len(tokens)-1] // '@'
+	tokens = tokens[:len(tokens)-1]
+	for _, t := range tokens {
+		if err := noFormat(pattern, t, "userinfo"); err != nil {
+			return err
+		}
+	}
+	if len(tokens) == 0 || tokens[0].tokenType == separator {
+		return newParseError(pattern, at.offset, "userinfo", "username is expected before '@'")
+	}
+	result.username = toPart(tokens[0])
+	switch {
+	case len(tokens) == 1:
+		// username only
+	case tokens[1].tokenType != separator || tokens[1].text != ":":
+		return newParseError(pattern, tokens[1].offset, "userinfo", "invalid text after username. only ':' or '@' is available")
+	case len(tokens) == 2:
+		result.password = &part[string]{partType: staticPart, value: ""}
+	case len(tokens) == 3 && tokens[2].tokenType != separator:
+		result.password = toPart(tokens[2])
+	default:
+		return newParseError(pattern, tokens[2].offset, "userinfo", "invalid character '%s' in userinfo", tokens[2].text)
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package urlf
 
 import (
+	"math/rand"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/alecthomas/assert/v2"
@@ -142,6 +145,129 @@ func TestParse(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "no param: single token",
+			args: `index.html`,
+			wantResult: &parseResult{
+				paths: []part[string]{{partType: staticPart, value: "index.html"}},
+			},
+		},
+		{
+			name: "param: userinfo",
+			args: `postgres://{}:{}@db.example.com:5432/app`,
+			wantResult: &parseResult{
+				protocol: &part[string]{partType: staticPart, value: "postgres"},
+				hostname: &part[string]{partType: staticPart, value: "db.example.com"},
+				port:     &part[uint16]{partType: staticPart, value: 5432},
+				paths:    []part[string]{{partType: staticPart, value: "/app"}},
+				username: &part[string]{partType: paramPart, index: 0},
+				password: &part[string]{partType: paramPart, index: 1},
+			},
+		},
+		{
+			name: "param: username only",
+			args: `//{}@{}`,
+			wantResult: &parseResult{
+				hostname: &part[string]{partType: paramPart, index: 1},
+				username: &part[string]{partType: paramPart, index: 0},
+			},
+		},
+		{
+			name: "param: query key and value",
+			args: `/search?{}={}`,
+			wantResult: &parseResult{
+				paths: []part[string]{{partType: staticPart, value: "/search"}},
+				queries: []queryPart{
+					{key: "{}", keyParts: []part[string]{{partType: paramPart, index: 0}}, value: part[string]{partType: paramPart, index: 1}},
+				},
+			},
+		},
+		{
+			name: "param: query key with static text",
+			args: `/items?filter[{}]={}&sort=asc`,
+			wantResult: &parseResult{
+				paths: []part[string]{{partType: staticPart, value: "/items"}},
+				queries: []queryPart{
+					{
+						key: "filter[{}]",
+						keyParts: []part[string]{
+							{partType: staticPart, value: "filter["},
+							{partType: paramPart, index: 0},
+							{partType: staticPart, value: "]"},
+						},
+						value: part[string]{partType: paramPart, index: 1},
+					},
+					{key: "sort", value: part[string]{partType: staticPart, value: "asc"}},
+				},
+			},
+		},
+		{
+			name: "param: query set",
+			args: `/items?{}`,
+			wantResult: &parseResult{
+				paths:   []part[string]{{partType: staticPart, value: "/items"}},
+				queries: []queryPart{{key: "", value: part[string]{partType: paramPart, index: 0}}},
+			},
+		},
+		{
+			name: "param: optional path sections",
+			args: `/api[/v{}]/items[/{}]`,
+			wantResult: &parseResult{
+				paths: []part[string]{
+					{partType: staticPart, value: "/api"},
+					{partType: optionalStart, value: "["},
+					{partType: staticPart, value: "/v"},
+					{partType: paramPart, index: 0},
+					{partType: optionalEnd, value: "]"},
+					{partType: staticPart, value: "/items"},
+					{partType: optionalStart, value: "["},
+					{partType: staticPart, value: "/"},
+					{partType: paramPart, index: 1},
+					{partType: optionalEnd, value: "]"},
+				},
+			},
+		},
+		{
+			name: "param: markers",
+			args: `/users/{!}?page={=1}&q={?}`,
+			wantResult: &parseResult{
+				paths: []part[string]{
+					{partType: staticPart, value: "/users/"},
+					{partType: paramPart, index: 0, required: true},
+				},
+				queries: []queryPart{
+					{key: "page", value: part[string]{partType: paramPart, index: 1, def: ptr("1")}},
+					{key: "q", value: part[string]{partType: paramPart, index: 2}},
+				},
+			},
+		},
+		{
+			name: "param: default with format spec",
+			args: `http://example.com:{=8080}/?page={=1:03d}`,
+			wantResult: &parseResult{
+				protocol: &part[string]{partType: staticPart, value: "http"},
+				hostname: &part[string]{partType: staticPart, value: "example.com"},
+				port:     &part[uint16]{partType: paramPart, index: 0, def: ptr("8080")},
+				paths:    []part[string]{{partType: staticPart, value: "/"}},
+				queries: []queryPart{
+					{key: "page", value: part[string]{partType: paramPart, index: 1, format: "03d", spec: &formatSpec{kind: specInt, text: "03d", printf: "%03d"}, def: ptr("1")}},
+				},
+			},
+		},
+		{
+			name: "static: brackets without placeholder",
+			args: `/items[1]/{}[/{}]`,
+			wantResult: &parseResult{
+				paths: []part[string]{
+					{partType: staticPart, value: "/items[1]/"},
+					{partType: paramPart, index: 0},
+					{partType: optionalStart, value: "["},
+					{partType: staticPart, value: "/"},
+					{partType: paramPart, index: 1},
+					{partType: optionalEnd, value: "]"},
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -151,3 +277,181 @@ func TestParse(t *testing.T) {
 		})
 	}
 }
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+	}{
+		{
+			name: "single placeholder",
+			args: `{}`,
+		},
+		{
+			name: "userinfo without username",
+			args: `http://@example.com`,
+		},
+		{
+			name: "userinfo without hostname",
+			args: `http://{}:{}@`,
+		},
+		{
+			name: "userinfo in path",
+			args: `http://example.com/{}@path`,
+		},
+		{
+			name: "query key placeholder without value",
+			args: `/items?filter[{}]&sort=asc`,
+		},
+		{
+			name: "query set followed by path",
+			args: `/items?{}/path`,
+		},
+		{
+			name: "format spec for port",
+			args: `http://example.com:{:unix}/`,
+		},
+		{
+			name: "format spec for query set",
+			args: `/items?{:unix}`,
+		},
+		{
+			name: "default port is not a number",
+			args: `http://example.com:{=http}/`,
+		},
+		{
+			name: "default for query set",
+			args: `/items?{=a}`,
+		},
+		{
+			name: "optional section not closed",
+			args: `/api[/{}/items`,
+		},
+		{
+			name: "placeholder after text outside optional section",
+			args: `/api/v{}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parse(tt.args)
+			assert.IsError(t, err, ErrParseFailed)
+		})
+	}
+}
+
+var splitterPattern = regexp.MustCompile(`(?::\/\/)|(?:\/\/)|[:/?&=#@]|\{(\*|,| |\||\[\]|\[0\])?(?:(!|\?)|=([^:}]*))?(?::([^}]*))?\}`)
+
+// scanRegexp is the previous regexp based tokenizer. It is used as a reference of scan.
+func scanRegexp(pattern string) []token {
+	i := 0
+	placeholderIndex := 0
+	var tokens []token
+	for _, m := range splitterPattern.FindAllStringSubmatchIndex(pattern, -1) {
+		if i < m[0] {
+			tokens = append(tokens, token{tokenType: static, text: pattern[i:m[0]], offset: i})
+		}
+		s := pattern[m[0]:m[1]]
+		if s[0] == '{' {
+			t := token{tokenType: placeholder, index: placeholderIndex, offset: m[0]}
+			if m[2] >= 0 {
+				t.style, _ = cutArrayStyle(pattern[m[2]:m[3]])
+			}
+			if m[4] >= 0 {
+				t.required = pattern[m[4]:m[5]] == "!"
+			}
+			if m[6] >= 0 {
+				def := pattern[m[6]:m[7]]
+				t.def = &def
+			}
+			if m[8] >= 0 {
+				t.format = pattern[m[8]:m[9]]
+			}
+			tokens = append(tokens, t)
+			placeholderIndex++
+		} else {
+			tokens = append(tokens, token{tokenType: separator, text: s, offset: m[0]})
+		}
+		i = m[1]
+	}
+	if i < len(pattern) {
+		tokens = append(tokens, token{tokenType: static, text: pattern[i:], offset: i})
+	}
+	return tokens
+}
+
+func TestScan(t *testing.T) {
+	patterns := []string{
+		"",
+		"http://example.com",
+		"{}://{}:{}@{}:{}/{}/path?key={}&{}={}&{}#{}",
+		"https://example.com/{:unix}?from={:2006-01-02T15:04}&{:}={:{}#{:",
+		"/users/{!}/{?:x}/{!x}?page={=1}&per={=20:d}&q={=}&x={?a}#{=a:b:c}",
+		"/items?id={,}&tag={[]!}&x={[0]=1:d}&y={|}&z={ }&w={*:x}&v={,,}&u={[1]}",
+		":///:://{}{{}}{}}{",
+		"https://example.com/東京/🐙?q=a b",
+	}
+	r := rand.New(rand.NewSource(1))
+	chars := []string{":", "/", "?", "&", "=", "#", "@", "{", "}", "{}", "a", "b", "東"}
+	for i := 0; i < 2000; i++ {
+		var p strings.Builder
+		for j := r.Intn(20); j > 0; j-- {
+			p.WriteString(chars[r.Intn(len(chars))])
+		}
+		patterns = append(patterns, p.String())
+	}
+	for _, p := range patterns {
+		want := scanRegexp(p)
+		got := scan(p)
+		if len(want) == 0 {
+			assert.Equal(t, 0, len(got), p)
+		} else {
+			assert.Equal(t, want, got, p)
+		}
+	}
+}
+
+func TestSplitHost(t *testing.T) {
+	hostPattern := regexp.MustCompile(`^(?P<protocol>\w+:\/\/)?(?P<hostname>[^:]+)(?P<port>:\d+)?`)
+	for _, host := range []string{
+		"example.com",
+		"https://example.com",
+		"https://example.com:8080",
+		"example.com:8080/path",
+		"a-b://example.com",
+		"localhost:",
+		"localhost:abc",
+		"https://localhost:99999",
+	} {
+		t.Run(host, func(t *testing.T) {
+			match := hostPattern.FindStringSubmatch(host)
+			protocol, hostname, port := splitHost(host)
+			assert.Equal(t, strings.TrimSuffix(match[1], "://"), protocol)
+			assert.Equal(t, match[2], hostname)
+			assert.Equal(t, strings.TrimPrefix(match[3], ":"), port)
+		})
+	}
+}
+
+var benchmarkPattern = "{}://{}:{}/api/users/{}/profile?key={}&page={}&{}#{}"
+
+func BenchmarkScan(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		scan(benchmarkPattern)
+	}
+}
+
+func BenchmarkScanRegexp(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		splitterPattern.FindAllStringIndex(benchmarkPattern, -1)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = parse(benchmarkPattern)
+	}
+}
@@ -0,0 +1,129 @@
+package urlf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// queryObject returns the map with string keys or the struct of the nested query set.
+// Values that have encoders, encoding.TextMarshaler or fmt.Stringer are not objects.
+func (st *formatState) queryObject(v any) (reflect.Value, bool) {
+	if hasText(v) {
+		return reflect.Value{}, false
+	}
+	if _, ok := st.encoder(v); ok {
+		return reflect.Value{}, false
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Map:
+		return rv, rv.Type().Key().Kind() == reflect.String
+	case reflect.Struct:
+		return rv, true
+	}
+	return reflect.Value{}, false
+}
+
+// maxQueryDepth is the max nesting level of query sets. It stops self-referencing maps and structs.
+const maxQueryDepth = 32
+
+// addQueryObject adds the entries of the map or the fields of the struct in bracket notation
+// (OpenAPI deepObject) like filter[owner][id]=7. The prefix is scratch[k0:k1] and k0 is -1 at the top level.
+// Map keys are sorted, and struct fields are in the declaration order.
+func (st *formatState) addQueryObject(index, k0, k1, depth int, rv reflect.Value) error {
+	if depth > maxQueryDepth {
+		return newFormatError(index, "query", nil, "query set is nested deeper than %d levels", maxQueryDepth)
+	}
+	if rv.Kind() == reflect.Map {
+		keys := rv.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(a.String(), b.String())
+		})
+		for _, key := range keys {
+			if err := st.addQueryEntry(index, k0, k1, depth, key.String(), rv.MapIndex(key).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("url"), ",")
+		if name == "-" {
+			continue
+		}
+		fv := rv.Field(i)
+		if f.Anonymous && name == "" { // embedded structs are flattened even if they are unexported
+			if ev := reflect.Indirect(fv); ev.Kind() == reflect.Struct && (!f.IsExported() || !hasText(fv.Interface())) {
+				if err := st.addQueryObject(index, k0, k1, depth+1, ev); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		v := fv.Interface()
+		if hasTagOption(opts, "omitempty") && isEmpty(v) {
+			continue
+		}
+		if err := st.addQueryEntry(index, k0, k1, depth, name, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addQueryEntry adds a value of the nested query set. nil, nil pointers and invalid nullable values are omitted.
+func (st *formatState) addQueryEntry(index, k0, k1, depth int, name string, v any) error {
+	if nv, ok := st.nullValue(v); ok {
+		v = nv
+	}
+	if v == nil || isNilPointer(v) || st.f.omitEmpty && isEmpty(v) {
+		return nil
+	}
+	if qe, ok := v.(QueryEncoder); ok {
+		v = qe.URLQuery()
+	}
+	nk0 := len(st.scratch)
+	if k0 < 0 {
+		st.scratch = append(st.scratch, name...)
+	} else {
+		st.scratch = append(st.scratch, st.scratch[k0:k1]...)
+		st.scratch = append(st.scratch, '[')
+		st.scratch = append(st.scratch, name...)
+		st.scratch = append(st.scratch, ']')
+	}
+	nk1 := len(st.scratch)
+	if rv, ok := st.queryObject(v); ok {
+		return st.addQueryObject(index, nk0, nk1, depth+1, rv)
+	}
+	if err := st.updateQuery(nk0, nk1, part[string]{partType: paramPart, index: index}, v); err != nil {
+		var fe *FormatError
+		if errors.As(err, &fe) {
+			fe.Reason = fmt.Sprintf("key '%s': %s", st.scratch[nk0:nk1], fe.Reason)
+		}
+		return err
+	}
+	return nil
+}
+
+// hasTagOption reports whether the comma separated options of the struct tag have the option.
+func hasTagOption(opts, option string) bool {
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if strings.TrimSpace(opt) == option {
+			return true
+		}
+	}
+	return false
+}
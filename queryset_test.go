@@ -0,0 +1,168 @@
+package urlf
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+type pageParams struct {
+	Page    int `url:"page,omitempty"`
+	PerPage int `url:"per_page"`
+}
+
+type issueQuery struct {
+	pageParams
+	Filter issueFilter `url:"filter"`
+	Sort   string      `url:"sort,omitempty"`
+	Labels []string    `url:"labels"`
+	Token  string      `url:"-"`
+	secret string
+}
+
+type issueFilter struct {
+	Status   string         `url:"status"`
+	Owner    *issueOwner    `url:"owner"`
+	Assignee sql.NullString `url:"assignee"`
+}
+
+type issueOwner struct {
+	ID int `url:"id"`
+}
+
+type taggedOptions struct {
+	A string `url:"a,omitempty "`
+	B string `url:"b,string,omitempty"`
+	C string `url:"c"`
+}
+
+type linkedNode struct {
+	Name string      `url:"name"`
+	Next *linkedNode `url:"next"`
+}
+
+func TestNestedQuerySet(t *testing.T) {
+	tests := []formatCase{
+		{
+			name:   "map",
+			format: "https://example.com/?{}",
+			args:   []any{map[string]any{"filter": map[string]any{"status": "open", "owner": map[string]any{"id": 7}}, "page": 2}},
+			want:   "https://example.com/?filter%5Bowner%5D%5Bid%5D=7&filter%5Bstatus%5D=open&page=2",
+		},
+		{
+			name:   "nil values",
+			format: "https://example.com/?{}",
+			args:   []any{map[string]any{"a": nil, "b": (*int)(nil), "c": sql.NullInt64{}, "d": 1}},
+			want:   "https://example.com/?d=1",
+		},
+		{
+			name:   "struct",
+			format: "https://example.com/issues?{}",
+			args:   []any{issueQuery{pageParams: pageParams{PerPage: 20}, Filter: issueFilter{Status: "open", Owner: &issueOwner{ID: 7}}, Labels: []string{"bug", "ui"}, Token: "x", secret: "y"}},
+			want:   "https://example.com/issues?filter%5Bowner%5D%5Bid%5D=7&filter%5Bstatus%5D=open&labels=bug&labels=ui&per_page=20",
+		},
+		{
+			name:   "struct pointer",
+			format: "https://example.com/?{}",
+			args:   []any{&issueFilter{Status: "open", Assignee: sql.NullString{String: "alice", Valid: true}}},
+			want:   "https://example.com/?assignee=alice&status=open",
+		},
+		{
+			name:   "struct order",
+			opt:    Opt{PreserveQueryOrder: true},
+			format: "https://example.com/issues?q=1&{}",
+			args:   []any{issueQuery{pageParams: pageParams{Page: 2, PerPage: 20}, Filter: issueFilter{Status: "open"}, Sort: "new"}},
+			want:   "https://example.com/issues?q=1&page=2&per_page=20&filter%5Bstatus%5D=open&sort=new",
+		},
+		{
+			name:   "map order",
+			opt:    Opt{PreserveQueryOrder: true},
+			format: "https://example.com/?{}",
+			args:   []any{map[string]any{"z": 1, "a": map[string]int{"y": 2, "b": 3}}},
+			want:   "https://example.com/?a%5Bb%5D=3&a%5By%5D=2&z=1",
+		},
+		{
+			name:   "array style",
+			opt:    Opt{ArrayStyle: ArrayBrackets},
+			format: "https://example.com/?{}",
+			args:   []any{map[string]any{"filter": map[string]any{"tags": []string{"a", "b"}}}},
+			want:   "https://example.com/?filter%5Btags%5D%5B%5D=a&filter%5Btags%5D%5B%5D=b",
+		},
+		{
+			name:   "nested url.Values",
+			format: "https://example.com/?{}",
+			args:   []any{map[string]any{"filter": url.Values{"status": {"open", "closed"}}}},
+			want:   "https://example.com/?filter%5Bstatus%5D=open&filter%5Bstatus%5D=closed",
+		},
+		{
+			name:   "omit empty",
+			opt:    Opt{OmitEmpty: true},
+			format: "https://example.com/?{}",
+			args:   []any{issueFilter{Owner: &issueOwner{}}},
+			want:   "https://example.com/",
+		},
+		{
+			name:   "tag options",
+			format: "https://example.com/?{}",
+			args:   []any{taggedOptions{}},
+			want:   "https://example.com/?c=",
+		},
+		{
+			name:   "nil set",
+			format: "https://example.com/?q=1&{}",
+			args:   []any{nil},
+			want:   "https://example.com/?q=1",
+		},
+	}
+	testFormat(t, tests)
+}
+
+func TestNestedQuerySetError(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []any
+		wantMsg string
+	}{
+		{name: "not a set", args: []any{10}, wantMsg: "query set must be url.Values, QueryEncoder, map or struct"},
+		{name: "int keys", args: []any{map[int]string{1: "a"}}, wantMsg: "query set must be url.Values, QueryEncoder, map or struct"},
+		{name: "unsupported value", args: []any{map[string]any{"filter": map[string]any{"f": func() {}}}}, wantMsg: "key 'filter[f]': unsupported type"},
+		{name: "self-referencing struct", args: []any{cyclicNode()}, wantMsg: "query set is nested deeper than 32 levels"},
+		{name: "self-referencing map", args: []any{cyclicMap()}, wantMsg: "query set is nested deeper than 32 levels"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := TryUrlf("https://example.com/?{}", tt.args...)
+			var fe *FormatError
+			assert.True(t, errors.As(err, &fe))
+			assert.Equal(t, tt.wantMsg, fe.Reason)
+		})
+	}
+}
+
+func TestNestedQuerySetDepth(t *testing.T) {
+	node := cyclicNode()
+	_, err := TryUrlf("https://example.com/?{}", node)
+	var fe *FormatError
+	assert.True(t, errors.As(err, &fe))
+	assert.Equal(t, any(node), fe.Value)
+	assert.Equal(t, "format failed: invalid query value (*urlf.linkedNode) for placeholder {0}: query set is nested deeper than 32 levels\n\thttps://example.com/?{}\n\t                     ^", err.Error())
+
+	_, err = TryUrlf("https://example.com/?{}", cyclicMap())
+	assert.True(t, errors.As(err, &fe))
+	assert.Contains(t, err.Error(), "invalid query value (map[string]interface {})")
+}
+
+func cyclicNode() *linkedNode {
+	n := &linkedNode{Name: "a"}
+	n.Next = n
+	return n
+}
+
+func cyclicMap() map[string]any {
+	m := map[string]any{"a": 1}
+	m["self"] = m
+	return m
+}
@@ -0,0 +1,148 @@
+package urlf
+
+import (
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// DefaultRedactKeys is a list of query keys that are masked by Result.Redacted by default.
+var DefaultRedactKeys = []string{"api_key", "apikey", "access_token", "token", "signature", "sig", "password"}
+
+const redactedValue = "xxxxx"
+
+// Formatter is a URL formatter that returns Result instead of string.
+//
+// Result is safe to log because its String method masks credentials.
+type Formatter struct {
+	f          *formatter
+	redactKeys []string
+}
+
+// NewFormatter creates a Formatter with options.
+func NewFormatter(o Opt) *Formatter {
+	redactKeys := o.RedactKeys
+	if redactKeys == nil {
+		redactKeys = DefaultRedactKeys
+	}
+	return &Formatter{
+		f:          newFormatter(o),
+		redactKeys: redactKeys,
+	}
+}
+
+// Format formats URL and returns Result.
+func (f *Formatter) Format(format string, args ...any) (*Result, error) {
+	t, err := f.f.cache.get(format)
+	if err != nil {
+		return nil, err
+	}
+	u, err := f.f.appendURL(nil, format, t, args)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{url: string(u), redactKeys: f.redactKeys, route: route(t)}, nil
+}
+
+// AppendURL appends the formatted URL to dst. See AppendURL function.
+func (f *Formatter) AppendURL(dst []byte, format string, args ...any) ([]byte, error) {
+	return f.f.appendURL(dst, format, nil, args)
+}
+
+// WriteURL writes the formatted URL to w. See WriteURL function.
+func (f *Formatter) WriteURL(w io.Writer, format string, args ...any) (int, error) {
+	return f.f.writeURL(w, format, args)
+}
+
+// MustFormat is a "Must" version of Format.
+func (f *Formatter) MustFormat(format string, args ...any) *Result {
+	if result, err := f.Format(format, args...); err != nil {
+		panic(mustError(format, err))
+	} else {
+		return result
+	}
+}
+
+// Result is a formatted URL.
+//
+// String and LogValue return the redacted URL, so it is safe to pass it to loggers.
+// Use Raw or URL to get the actual URL for the request.
+type Result struct {
+	url        string
+	redactKeys []string
+	route      string
+}
+
+// Raw returns the actual URL string that contains credentials.
+func (r Result) Raw() string {
+	return r.url
+}
+
+// URL returns the actual URL as *url.URL.
+func (r Result) URL() (*url.URL, error) {
+	return url.Parse(r.url)
+}
+
+// String returns the redacted URL. It implements fmt.Stringer.
+func (r Result) String() string {
+	return r.Redacted()
+}
+
+// LogValue returns the redacted URL. It implements slog.LogValuer.
+func (r Result) LogValue() slog.Value {
+	return slog.StringValue(r.Redacted())
+}
+
+// Redacted returns the URL whose password in userinfo and values of the redact keys in query are masked.
+// A username without a password is masked too because it is often a token.
+func (r Result) Redacted() string {
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return redactedValue
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redactQuery(u.RawQuery, r.redactKeys)
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); !ok {
+			u.User = url.User(redactedValue)
+		}
+	}
+	return u.Redacted()
+}
+
+// redactQuery masks values of keys without changing the order and the escaping of the other parameters.
+func redactQuery(rawQuery string, keys []string) string {
+	if len(keys) == 0 {
+		return rawQuery
+	}
+	var result strings.Builder
+	for i, pair := range strings.Split(rawQuery, "&") {
+		if i > 0 {
+			result.WriteByte('&')
+		}
+		rawKey, _, hasValue := strings.Cut(pair, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			key = rawKey
+		}
+		if hasValue && containsFold(keys, key) {
+			result.WriteString(rawKey)
+			result.WriteByte('=')
+			result.WriteString(redactedValue)
+		} else {
+			result.WriteString(pair)
+		}
+	}
+	return result.String()
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
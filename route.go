@@ -0,0 +1,103 @@
+package urlf
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Route returns the low-cardinality route label of the template like "api-server /users/{}/profile".
+//
+// It consists of the hostname in the template and the path whose placeholders are replaced with "{}".
+// The query and the fragment are not included. The hostname is the one in the template even if Opt.Hostname overrides it.
+func (t *Template) Route() string {
+	return route(t.t)
+}
+
+func route(t *parseResult) string {
+	var b strings.Builder
+	if t.hostname != nil {
+		if t.hostname.partType == paramPart {
+			b.WriteString("{}")
+		} else {
+			b.WriteString(t.hostname.value)
+		}
+		b.WriteByte(' ')
+	}
+	if len(t.paths) == 0 {
+		b.WriteByte('/')
+	}
+	for _, p := range t.paths {
+		if p.partType == paramPart {
+			b.WriteString("{}")
+		} else {
+			b.WriteString(p.value)
+		}
+	}
+	return b.String()
+}
+
+// Route returns the route label of the template that made the URL. See Template.Route.
+func (r Result) Route() string {
+	return r.route
+}
+
+// NewRequest creates an *http.Request of the URL whose context has the route label.
+func (r Result) NewRequest(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	return http.NewRequestWithContext(ContextWithRoute(ctx, r.Route()), method, r.url, body)
+}
+
+type routeKey struct{}
+
+// ContextWithRoute returns a copy of ctx that has the route label.
+func ContextWithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+// RouteFromContext returns the route label stored by ContextWithRoute.
+func RouteFromContext(ctx context.Context) (string, bool) {
+	route, ok := ctx.Value(routeKey{}).(string)
+	return route, ok && route != ""
+}
+
+// RouteLabel returns the label of the request like "GET api-server /users/{}/profile" for metrics and span names.
+//
+// If the request context doesn't have the route, it returns the method and the hostname
+// to keep the cardinality low.
+func RouteLabel(req *http.Request) string {
+	if route, ok := RouteFromContext(req.Context()); ok {
+		return req.Method + " " + route
+	}
+	if req.URL != nil {
+		return req.Method + " " + req.URL.Hostname()
+	}
+	return req.Method
+}
+
+// Transport is an http.RoundTripper that reports the route label of each request.
+//
+// Create requests with Result.NewRequest or ContextWithRoute to label them with the URL template.
+type Transport struct {
+	// Base is the underlying RoundTripper. http.DefaultTransport is used if it is nil.
+	Base http.RoundTripper
+	// Observe is called after each round trip with the label from RouteLabel.
+	Observe func(label string, req *http.Request, resp *http.Response, err error, elapsed time.Duration)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t.Observe == nil {
+		return base.RoundTrip(req)
+	}
+	label := RouteLabel(req)
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	t.Observe(label, req, resp, err, time.Since(start))
+	return resp, err
+}
@@ -0,0 +1,96 @@
+package urlf
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestRoute(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		want   string
+	}{
+		{name: "path placeholders", format: "https://api-server/users/{}/profile?tab={}", want: "api-server /users/{}/profile"},
+		{name: "path tail", format: "https://api-server/files/{}#{}", want: "api-server /files/{}"},
+		{name: "static", format: "https://api-server/health", want: "api-server /health"},
+		{name: "no path", format: "https://api-server?q={}", want: "api-server /"},
+		{name: "host placeholder", format: "https://{}:{}/users/{}", want: "{} /users/{}"},
+		{name: "optional sections", format: "https://api-server/api[/v{:d}]/items[/{}]", want: "api-server /api[/v{}]/items[/{}]"},
+		{name: "userinfo", format: "https://{}:{}@api-server/users/{}", want: "api-server /users/{}"},
+		{name: "relative path", format: "/users/{}", want: "/users/{}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MustCompile(tt.format).Route())
+		})
+	}
+}
+
+func TestResultRoute(t *testing.T) {
+	f := NewFormatter(Opt{Hostname: "https://localhost:8080", Cache: NewCache(0)})
+	r := f.MustFormat("https://api-server/users/{}/profile?tab={}", 1000, "posts")
+	assert.Equal(t, "https://localhost:8080/users/1000/profile?tab=posts", r.Raw())
+	assert.Equal(t, "api-server /users/{}/profile", r.Route())
+	assert.Equal(t, "", Result{}.Route())
+}
+
+func TestResultRouteCacheStats(t *testing.T) {
+	c := NewCache(10)
+	passThrough := func(next FormatFunc) FormatFunc {
+		return func(c *Call) (*url.URL, error) {
+			return next(c)
+		}
+	}
+	for _, opt := range []Opt{{Cache: c}, {Cache: c, Middlewares: []Middleware{passThrough}}} {
+		r := NewFormatter(opt).MustFormat("https://api-server/users/{}", 1000)
+		r.Route()
+		assert.Equal(t, "api-server /users/{}", r.Route())
+	}
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1, Len: 1, Size: 10}, c.Stats())
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	var labels []string
+	client := &http.Client{Transport: &Transport{
+		Observe: func(label string, req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+			labels = append(labels, label)
+		},
+	}}
+
+	f := NewFormatter(Opt{Hostname: server.URL})
+	req, err := f.MustFormat("http://api-server/users/{}/profile", 1000).NewRequest(context.Background(), http.MethodGet, nil)
+	assert.NoError(t, err)
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	req, err = http.NewRequest(http.MethodPost, server.URL+"/users/1000", nil)
+	assert.NoError(t, err)
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, []string{"GET api-server /users/{}/profile", "POST 127.0.0.1"}, labels)
+}
+
+func TestRouteFromContext(t *testing.T) {
+	_, ok := RouteFromContext(context.Background())
+	assert.False(t, ok)
+	route, ok := RouteFromContext(ContextWithRoute(context.Background(), "api-server /users/{}"))
+	assert.True(t, ok)
+	assert.Equal(t, "api-server /users/{}", route)
+}
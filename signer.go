@@ -0,0 +1,161 @@
+package urlf
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("signed URL is expired")
+)
+
+const (
+	// ExpiresKey is a query key for the expiry time (unix seconds) of the signed URL.
+	ExpiresKey = "expires"
+	// SignatureKey is a query key for the signature of the signed URL.
+	SignatureKey = "signature"
+)
+
+// Signer signs formatted URLs.
+//
+// If Opt.Signer is set, the formatter calls Sign for every URL it produces.
+type Signer interface {
+	Sign(u *url.URL) error
+}
+
+// HMACSigner is a Signer that adds expires and signature (HMAC-SHA256) query parameters.
+//
+// The signature covers the scheme, the host, the escaped path and the canonical query (see CanonicalQuery) including expires.
+type HMACSigner struct {
+	Key []byte
+	// TTL is a lifetime of the signed URL. If it is zero, the URL doesn't expire.
+	TTL time.Duration
+	// Now returns the current time. time.Now is used if it is nil.
+	Now func() time.Time
+	// IgnoreHost excludes the scheme and the host from the signature, so the URL can be verified behind proxies and CDNs
+	// that rewrite the host. Any host that shares the key accepts the URL then.
+	IgnoreHost bool
+}
+
+// NewHMACSigner creates HMACSigner.
+func NewHMACSigner(key []byte, ttl time.Duration) *HMACSigner {
+	return &HMACSigner{Key: key, TTL: ttl}
+}
+
+func (s *HMACSigner) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// Sign appends expires and signature query parameters to the URL.
+// Existing expires and signature parameters are replaced.
+func (s *HMACSigner) Sign(u *url.URL) error {
+	rawQuery := removeQueryKeys(u.RawQuery, ExpiresKey, SignatureKey)
+	if s.TTL != 0 {
+		rawQuery = appendQuery(rawQuery, ExpiresKey, strconv.FormatInt(s.now().Add(s.TTL).Unix(), 10))
+	}
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return err
+	}
+	u.RawQuery = appendQuery(rawQuery, SignatureKey, s.signature(u, q))
+	return nil
+}
+
+// Verify checks the signature and the expiry of the signed URL.
+//
+// It returns ErrInvalidSignature or ErrExpired if the URL is not valid.
+func (s *HMACSigner) Verify(u *url.URL) error {
+	q, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	sig := q.Get(SignatureKey)
+	q.Del(SignatureKey)
+	if sig == "" || !hmac.Equal([]byte(sig), []byte(s.signature(u, q))) {
+		return ErrInvalidSignature
+	}
+	if e := q.Get(ExpiresKey); e != "" {
+		expires, err := strconv.ParseInt(e, 10, 64)
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		if s.now().Unix() > expires {
+			return ErrExpired
+		}
+	}
+	return nil
+}
+
+func (s *HMACSigner) signature(u *url.URL, q url.Values) string {
+	mac := hmac.New(sha256.New, s.Key)
+	if !s.IgnoreHost {
+		mac.Write([]byte(strings.ToLower(u.Scheme)))
+		mac.Write([]byte("://"))
+		mac.Write([]byte(strings.ToLower(u.Host)))
+	}
+	mac.Write([]byte(u.EscapedPath()))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(CanonicalQuery(q)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CanonicalQuery returns a stable query string for signing.
+//
+// Keys are sorted in byte order, the values of the same key keep their order,
+// and keys and values are escaped by url.QueryEscape. SignatureKey is excluded.
+func CanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		if k != SignatureKey {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	var result strings.Builder
+	for _, k := range keys {
+		for _, v := range q[k] {
+			if result.Len() > 0 {
+				result.WriteByte('&')
+			}
+			result.WriteString(url.QueryEscape(k))
+			result.WriteByte('=')
+			result.WriteString(url.QueryEscape(v))
+		}
+	}
+	return result.String()
+}
+
+// removeQueryKeys removes parameters from the raw query without changing the others.
+func removeQueryKeys(rawQuery string, keys ...string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	pairs := strings.Split(rawQuery, "&")
+	result := pairs[:0]
+	for _, pair := range pairs {
+		rawKey, _, _ := strings.Cut(pair, "=")
+		if key, err := url.QueryUnescape(rawKey); err == nil && slices.Contains(keys, key) {
+			continue
+		}
+		result = append(result, pair)
+	}
+	return strings.Join(result, "&")
+}
+
+func appendQuery(rawQuery, key, value string) string {
+	if rawQuery != "" {
+		rawQuery += "&"
+	}
+	return rawQuery + url.QueryEscape(key) + "=" + url.QueryEscape(value)
+}
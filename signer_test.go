@@ -0,0 +1,107 @@
+package urlf
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestHMACSigner(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	signer := &HMACSigner{Key: []byte("secret"), TTL: time.Hour, Now: func() time.Time { return now }}
+
+	signed, err := TryCustomFormatter(Opt{Signer: signer})("https://example.com/files/{}?download={}", "report.pdf", "true")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/files/report.pdf?download=true&expires=1704070800&signature=71a84f825b6a18918f7133c110c07fcacb714ca6cf68be1c20a2f01862115df8", signed)
+
+	tests := []struct {
+		name       string
+		url        string
+		now        time.Time
+		ignoreHost bool
+		wantErr    error
+	}{
+		{
+			name: "valid",
+			url:  signed,
+			now:  now,
+		},
+		{
+			name: "valid (reordered query)",
+			url:  "https://example.com/files/report.pdf?expires=1704070800&signature=71a84f825b6a18918f7133c110c07fcacb714ca6cf68be1c20a2f01862115df8&download=true",
+			now:  now,
+		},
+		{
+			name:    "tampered host",
+			url:     "https://evil.example.com/files/report.pdf?download=true&expires=1704070800&signature=71a84f825b6a18918f7133c110c07fcacb714ca6cf68be1c20a2f01862115df8",
+			now:     now,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "tampered scheme",
+			url:     "http://example.com/files/report.pdf?download=true&expires=1704070800&signature=71a84f825b6a18918f7133c110c07fcacb714ca6cf68be1c20a2f01862115df8",
+			now:     now,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:       "ignore host",
+			url:        "https://cdn.example.com/files/report.pdf?download=true&expires=1704070800&signature=364ca606226991ef04943cb0678a1d238ce08ab6ae176e0de8d0be4fbc2181cc",
+			now:        now,
+			ignoreHost: true,
+		},
+		{
+			name:    "tampered path",
+			url:     "https://example.com/files/secret.pdf?download=true&expires=1704070800&signature=71a84f825b6a18918f7133c110c07fcacb714ca6cf68be1c20a2f01862115df8",
+			now:     now,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "tampered expires",
+			url:     "https://example.com/files/report.pdf?download=true&expires=1704074400&signature=71a84f825b6a18918f7133c110c07fcacb714ca6cf68be1c20a2f01862115df8",
+			now:     now,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "no signature",
+			url:     "https://example.com/files/report.pdf?download=true&expires=1704070800",
+			now:     now,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "expired",
+			url:     signed,
+			now:     now.Add(2 * time.Hour),
+			wantErr: ErrExpired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := &HMACSigner{Key: []byte("secret"), Now: func() time.Time { return tt.now }, IgnoreHost: tt.ignoreHost}
+			u, err := url.Parse(tt.url)
+			assert.NoError(t, err)
+			err = verifier.Verify(u)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.IsError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHMACSignerResign(t *testing.T) {
+	signer := NewHMACSigner([]byte("secret"), 0)
+	u, err := url.Parse("https://example.com/files?b=2&signature=old&a=1")
+	assert.NoError(t, err)
+	assert.NoError(t, signer.Sign(u))
+	assert.Equal(t, "b=2&a=1&signature=d62978ac79807d40cbb444e76a45fd6ab02bfc1a82968a7583b40b8c178f7336", u.RawQuery)
+	assert.NoError(t, signer.Verify(u))
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	q, err := url.ParseQuery("z=1&a=b%20c&a=a&signature=xxx&%E3%81%82=%2B")
+	assert.NoError(t, err)
+	assert.Equal(t, "a=b+c&a=a&z=1&%E3%81%82=%2B", CanonicalQuery(q))
+}
@@ -0,0 +1,177 @@
+package urlf
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type specKind int
+
+const (
+	specTime   specKind = iota + 1 // time formats and layouts like {:unixms} or {:2006-01-02}
+	specInt                        // {:05d}, {:x}, {:X}, {:o}, {:b}
+	specFloat                      // {:.2f}, {:e}, {:g}
+	specString                     // {:10s}
+	specLower                      // {:lower}
+	specUpper                      // {:upper}
+)
+
+// formatSpec is a parsed format spec of the placeholder like {:05d}.
+type formatSpec struct {
+	kind   specKind
+	text   string // spec without ':'
+	printf string // format for fmt.Appendf like "%05d"
+}
+
+// parseSpec parses the format spec. It accepts printf style verbs, "lower", "upper" and time formats.
+func parseSpec(text string) (*formatSpec, error) {
+	switch text {
+	case "lower":
+		return &formatSpec{kind: specLower, text: text}, nil
+	case "upper":
+		return &formatSpec{kind: specUpper, text: text}, nil
+	}
+	if kind, ok := printfKind(text); ok {
+		return &formatSpec{kind: kind, text: text, printf: "%" + text}, nil
+	}
+	// digits of 4 or more like "2006" or "20060102" are time layouts, and shorter ones are widths
+	if i := printfPrefix(text); i == len(text) && (i < 4 || strings.Trim(text, "0123456789") != "") {
+		return nil, fmt.Errorf("format spec ':%s' needs a verb like d, f or s", text)
+	} else if i > 0 && i < len(text) && strings.IndexByte(printfVerbs, text[i]) >= 0 {
+		return nil, fmt.Errorf("invalid format spec ':%s'. unexpected text '%s' after the verb", text, text[i+1:])
+	}
+	if err := checkTimeFormat(text); err != nil {
+		return nil, fmt.Errorf("unknown format spec ':%s'", text)
+	}
+	return &formatSpec{kind: specTime, text: text}, nil
+}
+
+const printfVerbs = "dxXobfFeEgGs"
+
+// printfKind checks the printf style spec: flags, width, precision and a verb like "-08.3f".
+func printfKind(text string) (specKind, bool) {
+	i := printfPrefix(text)
+	if i != len(text)-1 {
+		return 0, false
+	}
+	switch text[i] {
+	case 'd', 'x', 'X', 'o', 'b':
+		return specInt, true
+	case 'f', 'F', 'e', 'E', 'g', 'G':
+		return specFloat, true
+	case 's':
+		return specString, true
+	}
+	return 0, false
+}
+
+// printfPrefix returns the length of flags, width and precision at the beginning of the spec.
+func printfPrefix(text string) int {
+	i := 0
+	for i < len(text) && strings.IndexByte("-+ #0", text[i]) >= 0 {
+		i++
+	}
+	for i < len(text) && '0' <= text[i] && text[i] <= '9' {
+		i++
+	}
+	if i < len(text) && text[i] == '.' {
+		i++
+		for i < len(text) && '0' <= text[i] && text[i] <= '9' {
+			i++
+		}
+	}
+	return i
+}
+
+// appendSpec appends the value formatted by the spec except time formats.
+// It returns an error if the spec doesn't fit the type of the value.
+func (st *formatState) appendSpec(dst []byte, v any, spec *formatSpec) ([]byte, bool, error) {
+	if v == nil || isNilPointer(v) {
+		return dst, false, nil
+	}
+	switch spec.kind {
+	case specInt:
+		n, ok := intArg(v)
+		if !ok {
+			return dst, false, fmt.Errorf("format spec ':%s' is available only for integer values", spec.text)
+		}
+		return fmt.Appendf(dst, spec.printf, n), true, nil
+	case specFloat:
+		n, ok := floatArg(v)
+		if !ok {
+			return dst, false, fmt.Errorf("format spec ':%s' is available only for number values", spec.text)
+		}
+		return fmt.Appendf(dst, spec.printf, n), true, nil
+	}
+	if _, ok := floatArg(v); ok && !hasText(v) { // enums with String method are text
+		return dst, false, fmt.Errorf("format spec ':%s' is available only for text values", spec.text)
+	}
+	start := len(dst)
+	dst, ok, err := st.appendValue(dst, v, nil)
+	if err != nil || !ok {
+		return dst, ok, err
+	}
+	text := string(dst[start:])
+	switch spec.kind {
+	case specLower:
+		text = strings.ToLower(text)
+	case specUpper:
+		text = strings.ToUpper(text)
+	default:
+		text = fmt.Sprintf(spec.printf, text)
+	}
+	return append(dst[:start], text...), true, nil
+}
+
+// intArg returns the integer value for fmt.Appendf.
+func intArg(v any) (any, bool) {
+	switch v := v.(type) {
+	case *big.Int:
+		return v, true
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if rv.Type() == reflect.TypeFor[time.Duration]() {
+			return nil, false
+		}
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), true
+	}
+	return nil, false
+}
+
+// floatArg returns the number value for fmt.Appendf. Integers are accepted too.
+func floatArg(v any) (any, bool) {
+	switch v := v.(type) {
+	case *big.Float:
+		return v, true
+	case *big.Int:
+		return new(big.Float).SetInt(v), true
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	if n, ok := intArg(v); ok {
+		switch n := n.(type) {
+		case int64:
+			return float64(n), true
+		case uint64:
+			return float64(n), true
+		}
+	}
+	return nil, false
+}
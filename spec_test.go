@@ -0,0 +1,81 @@
+package urlf
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestFormatSpec(t *testing.T) {
+	id := 42
+	tests := []formatCase{
+		{name: "zero padding", format: "https://example.com/items/{:05d}", args: []any{id}, want: "https://example.com/items/00042"},
+		{name: "pointer", format: "https://example.com/items/{:05d}", args: []any{&id}, want: "https://example.com/items/00042"},
+		{name: "hex", format: "https://example.com/colors/{:x}?c={:X}", args: []any{uint32(0xff00aa), 255}, want: "https://example.com/colors/ff00aa?c=FF"},
+		{name: "named int", format: "https://example.com/users/{:08d}", args: []any{userID(1)}, want: "https://example.com/users/00000001"},
+		{name: "big int", format: "https://example.com/{:x}", args: []any{big.NewInt(4095)}, want: "https://example.com/fff"},
+		{name: "json.Number", format: "https://example.com/{:04d}?v={:.1f}", args: []any{json.Number("7"), json.Number("1.25")}, want: "https://example.com/0007?v=1.2"},
+		{name: "float", format: "https://example.com/map?lat={:.2f}&lng={:.2f}", args: []any{35.68123, float32(139.76712)}, want: "https://example.com/map?lat=35.68&lng=139.77"},
+		{name: "int as float", format: "https://example.com/?v={:.1f}", args: []any{3}, want: "https://example.com/?v=3.0"},
+		{name: "exponent", format: "https://example.com/?v={:e}", args: []any{1500.0}, want: "https://example.com/?v=1.500000e%2B03"},
+		{name: "lower", format: "https://example.com/status/{:lower}", args: []any{status("OPEN")}, want: "https://example.com/status/open"},
+		{name: "stringer enum", format: "https://example.com/?c={:upper}", args: []any{color(1)}, want: "https://example.com/?c=GREEN"},
+		{name: "string width", format: "https://example.com/{:-5s}|", args: []any{"ab"}, want: "https://example.com/ab%20%20%20%7C"},
+		{name: "query key and fragment", format: "https://example.com/?{:upper}=1#{:03d}", args: []any{"key", 7}, want: "https://example.com/?KEY=1#007"},
+		{name: "slice", format: "https://example.com/{:03d}", args: []any{[]int{1, 2}}, want: "https://example.com/001/002"},
+		{name: "slice query", format: "https://example.com/?s={:upper}&n={:02d}", args: []any{[]string{"a", "b"}, []int{1, 2}}, want: "https://example.com/?n=01&n=02&s=A&s=B"},
+		{name: "other slice", format: "https://example.com/{:02d}", args: []any{[]int64{1, 2}}, want: "https://example.com/01/02"},
+		{name: "nil", format: "https://example.com/?a={:05d}", args: []any{nil}, want: "https://example.com/"},
+	}
+	testFormat(t, tests)
+}
+
+func TestFormatSpecError(t *testing.T) {
+	tests := []formatErrorCase{
+		{name: "string for int", format: "https://example.com/{:05d}", args: []any{"abc"}, wantMsg: "format spec ':05d' is available only for integer values"},
+		{name: "float for int", format: "https://example.com/{:x}", args: []any{1.5}, wantMsg: "format spec ':x' is available only for integer values"},
+		{name: "string for float", format: "https://example.com/?v={:.2f}", args: []any{"abc"}, wantMsg: "format spec ':.2f' is available only for number values"},
+		{name: "number for text", format: "https://example.com/{:lower}", args: []any{10}, wantMsg: "format spec ':lower' is available only for text values"},
+		{name: "slice element", format: "https://example.com/{:d}", args: []any{[]any{1, "a"}}, wantMsg: "element 1: format spec ':d' is available only for integer values"},
+	}
+	testFormatError(t, tests)
+}
+
+func TestParseSpec(t *testing.T) {
+	for _, spec := range []string{"05d", "x", "-8.3f", "+.2e", "10s", "lower", "upper", "unixms", "2006-01-02", "20060102", "Mon", "Jan 2"} {
+		_, err := parseSpec(spec)
+		assert.NoError(t, err, spec)
+	}
+	for _, spec := range []string{"Lower", "millis", ".f.", "%d", "abc"} {
+		_, err := parseSpec(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestParseSpecError(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantMsg string
+	}{
+		{spec: "5", wantMsg: "format spec ':5' needs a verb like d, f or s"},
+		{spec: "-10", wantMsg: "format spec ':-10' needs a verb like d, f or s"},
+		{spec: ".2", wantMsg: "format spec ':.2' needs a verb like d, f or s"},
+		{spec: "05d=7", wantMsg: "invalid format spec ':05d=7'. unexpected text '=7' after the verb"},
+		{spec: "millis", wantMsg: "unknown format spec ':millis'"},
+		{spec: "x2", wantMsg: "unknown format spec ':x2'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := parseSpec(tt.spec)
+			assert.EqualError(t, err, tt.wantMsg)
+		})
+	}
+	_, err := TryUrlf("https://example.com/{:5}", 1)
+	assert.IsError(t, err, ErrParseFailed)
+	_, err = TryUrlf("https://example.com/{:x2}", 255)
+	var pe *ParseError
+	assert.True(t, errors.As(err, &pe))
+}
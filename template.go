@@ -0,0 +1,218 @@
+package urlf
+
+import (
+	"slices"
+	"sort"
+)
+
+// PlaceholderKind is a location of the placeholder in the URL template.
+type PlaceholderKind int
+
+const (
+	KindProtocol    PlaceholderKind = iota + 1 // {}://
+	KindUsername                               // //{}@ or //{}:password@
+	KindPassword                               // //user:{}@
+	KindHost                                   // //{}/
+	KindPort                                   // //host:{}
+	KindPathSegment                            // /{}/ followed by other path text
+	KindPathTail                               // /{} at the end of the path
+	KindQueryKey                               // ?{}=value
+	KindQueryValue                             // ?key={}
+	KindQuerySet                               // ?{}
+	KindFragment                               // #{}
+)
+
+var kindNames = map[PlaceholderKind]string{
+	KindProtocol:    "protocol",
+	KindUsername:    "username",
+	KindPassword:    "password",
+	KindHost:        "host",
+	KindPort:        "port",
+	KindPathSegment: "path-segment",
+	KindPathTail:    "path-tail",
+	KindQueryKey:    "query-key",
+	KindQueryValue:  "query-value",
+	KindQuerySet:    "query-set",
+	KindFragment:    "fragment",
+}
+
+func (k PlaceholderKind) String() string {
+	if n, ok := kindNames[k]; ok {
+		return n
+	}
+	return "unknown"
+}
+
+// Types returns Go types that the placeholder of the kind accepts. "[]T" is a slice of the other types.
+func (k PlaceholderKind) Types() []string {
+	switch k {
+	case KindProtocol, KindUsername, KindPassword, KindHost:
+		return slices.Concat(textTypes, []string{"nil"})
+	case KindPort:
+		return slices.Concat(integerTypes, []string{"nil"})
+	case KindPathSegment, KindPathTail:
+		return slices.Concat(scalarTypes, []string{"[]string", "[]int", "[]any", "[]T", "urlf.PathSegmenter", "nil"})
+	case KindQueryValue:
+		return slices.Concat(scalarTypes, []string{"[]string", "[]int", "[]any", "[]T", "nil"})
+	case KindQueryKey, KindFragment:
+		return slices.Concat(scalarTypes, []string{"nil"})
+	case KindQuerySet:
+		return []string{"url.Values", "urlf.QueryEncoder", "map[string]any", "struct", "nil"}
+	}
+	return nil
+}
+
+// Placeholder is a description of the placeholder in the URL template.
+type Placeholder struct {
+	Index int // index of the argument
+	// Name is a readable label derived from the template:
+	// the query key for query values, the preceding path segment for path placeholders,
+	// and the kind name for the others.
+	Name       string
+	Kind       PlaceholderKind
+	QueryKey   string     // query key for KindQueryValue and KindQueryKey like "page" or "filter[{}]"
+	Types      []string   // allowed Go types
+	Format     string     // format spec like "unixms" of {:unixms}
+	Required   bool       // {!} placeholder that doesn't accept nil
+	Default    *string    // default value of {=value} used for nil
+	ArrayStyle ArrayStyle // array style of the query value like ArrayComma of {,}
+}
+
+// Template is a parsed URL template for introspection.
+type Template struct {
+	format string
+	t      *parseResult
+}
+
+// Compile parses the URL template. The parsed template is stored in the shared cache too.
+func Compile(format string) (*Template, error) {
+	t, err := defaultCache.get(format)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{format: format, t: t}, nil
+}
+
+// MustCompile is a "Must" version of Compile.
+func MustCompile(format string) *Template {
+	if t, err := Compile(format); err != nil {
+		panic(err)
+	} else {
+		return t
+	}
+}
+
+// String returns the template text.
+func (t *Template) String() string {
+	return t.format
+}
+
+// Scheme returns the static scheme. It returns an empty string if the scheme is a placeholder or omitted.
+func (t *Template) Scheme() string {
+	if t.t.protocol != nil && t.t.protocol.partType == staticPart {
+		return t.t.protocol.value
+	}
+	return ""
+}
+
+// Host returns the static hostname. It returns an empty string if the hostname is a placeholder or omitted.
+func (t *Template) Host() string {
+	if t.t.hostname != nil && t.t.hostname.partType == staticPart {
+		return t.t.hostname.value
+	}
+	return ""
+}
+
+// Port returns the static port number. It returns 0 if the port is a placeholder or omitted.
+func (t *Template) Port() uint16 {
+	if t.t.port != nil && t.t.port.partType == staticPart {
+		return t.t.port.value
+	}
+	return 0
+}
+
+// PathPrefix returns the static path before the first path placeholder.
+func (t *Template) PathPrefix() string {
+	if len(t.t.paths) > 0 && t.t.paths[0].partType == staticPart {
+		return t.t.paths[0].value
+	}
+	return ""
+}
+
+// Placeholders returns the placeholders in the order of the argument index.
+func (t *Template) Placeholders() []Placeholder {
+	var result []Placeholder
+	add := func(p *part[string], kind PlaceholderKind, name, queryKey string) {
+		if p != nil && p.partType == paramPart {
+			result = append(result, newPlaceholder(p, kind, name, queryKey))
+		}
+	}
+	add(t.t.protocol, KindProtocol, KindProtocol.String(), "")
+	add(t.t.username, KindUsername, KindUsername.String(), "")
+	add(t.t.password, KindPassword, KindPassword.String(), "")
+	add(t.t.hostname, KindHost, KindHost.String(), "")
+	if t.t.port != nil && t.t.port.partType == paramPart {
+		result = append(result, newPlaceholder(t.t.port, KindPort, KindPort.String(), ""))
+	}
+	for i, p := range t.t.paths {
+		if p.partType != paramPart {
+			continue
+		}
+		// brackets of optional sections are skipped
+		next := i + 1
+		for next < len(t.t.paths) && t.t.paths[next].partType == optionalEnd {
+			next++
+		}
+		kind := KindPathTail
+		if next < len(t.t.paths) && t.t.paths[next].value != "/" {
+			kind = KindPathSegment
+		}
+		name := kind.String()
+		for j := i - 1; j >= 0 && t.t.paths[j].partType != paramPart; j-- {
+			if t.t.paths[j].partType != staticPart {
+				continue
+			}
+			if segment := lastSegment(t.t.paths[j].value); segment != "" {
+				name = segment
+				break
+			}
+		}
+		add(&t.t.paths[i], kind, name, "")
+	}
+	for _, q := range t.t.queries {
+		for _, k := range q.keyParts {
+			add(&k, KindQueryKey, q.key, q.key)
+		}
+		switch {
+		case q.keyParts != nil:
+			add(&q.value, KindQueryValue, q.key, q.key)
+		case q.key == "":
+			add(&q.value, KindQuerySet, "query", "")
+		default:
+			add(&q.value, KindQueryValue, q.key, q.key)
+		}
+	}
+	add(t.t.fragment, KindFragment, KindFragment.String(), "")
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Index < result[j].Index
+	})
+	return result
+}
+
+// newPlaceholder describes the placeholder part.
+func newPlaceholder[T comparable](p *part[T], kind PlaceholderKind, name, queryKey string) Placeholder {
+	return Placeholder{Index: p.index, Name: name, Kind: kind, QueryKey: queryKey, Types: kind.Types(), Format: p.format, Required: p.required, Default: p.def, ArrayStyle: p.style}
+}
+
+// lastSegment returns the last non-empty path segment like "users" of "/api/users/".
+func lastSegment(path string) string {
+	end := len(path)
+	for end > 0 && path[end-1] == '/' {
+		end--
+	}
+	start := end
+	for start > 0 && path[start-1] != '/' {
+		start--
+	}
+	return path[start:end]
+}
@@ -0,0 +1,110 @@
+package urlf
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestTemplatePlaceholders(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		want   []Placeholder
+	}{
+		{
+			name:   "host parts",
+			format: "{}://{}:{}@{}:{}/",
+			want: []Placeholder{
+				{Index: 0, Name: "protocol", Kind: KindProtocol, Types: KindProtocol.Types()},
+				{Index: 1, Name: "username", Kind: KindUsername, Types: KindUsername.Types()},
+				{Index: 2, Name: "password", Kind: KindPassword, Types: KindPassword.Types()},
+				{Index: 3, Name: "host", Kind: KindHost, Types: KindHost.Types()},
+				{Index: 4, Name: "port", Kind: KindPort, Types: KindPort.Types()},
+			},
+		},
+		{
+			name:   "path",
+			format: "https://example.com/users/{}/files/{}/",
+			want: []Placeholder{
+				{Index: 0, Name: "users", Kind: KindPathSegment, Types: KindPathSegment.Types()},
+				{Index: 1, Name: "files", Kind: KindPathTail, Types: KindPathTail.Types()},
+			},
+		},
+		{
+			name:   "query and fragment",
+			format: "/search?word={}&filter[{}]={}&{}#{}",
+			want: []Placeholder{
+				{Index: 0, Name: "word", Kind: KindQueryValue, QueryKey: "word", Types: KindQueryValue.Types()},
+				{Index: 1, Name: "filter[{}]", Kind: KindQueryKey, QueryKey: "filter[{}]", Types: KindQueryKey.Types()},
+				{Index: 2, Name: "filter[{}]", Kind: KindQueryValue, QueryKey: "filter[{}]", Types: KindQueryValue.Types()},
+				{Index: 3, Name: "query", Kind: KindQuerySet, Types: KindQuerySet.Types()},
+				{Index: 4, Name: "fragment", Kind: KindFragment, Types: KindFragment.Types()},
+			},
+		},
+		{
+			name:   "format spec",
+			format: "/events/{:date}?since={:unixms}",
+			want: []Placeholder{
+				{Index: 0, Name: "events", Kind: KindPathTail, Types: KindPathTail.Types(), Format: "date"},
+				{Index: 1, Name: "since", Kind: KindQueryValue, QueryKey: "since", Types: KindQueryValue.Types(), Format: "unixms"},
+			},
+		},
+		{
+			name:   "optional path sections",
+			format: "/api[/v{}]/users[/{}]",
+			want: []Placeholder{
+				{Index: 0, Name: "v", Kind: KindPathSegment, Types: KindPathSegment.Types()},
+				{Index: 1, Name: "users", Kind: KindPathTail, Types: KindPathTail.Types()},
+			},
+		},
+		{
+			name:   "markers",
+			format: "/users/{!}?page={=1}&q={?}",
+			want: []Placeholder{
+				{Index: 0, Name: "users", Kind: KindPathTail, Types: KindPathTail.Types(), Required: true},
+				{Index: 1, Name: "page", Kind: KindQueryValue, QueryKey: "page", Types: KindQueryValue.Types(), Default: ptr("1")},
+				{Index: 2, Name: "q", Kind: KindQueryValue, QueryKey: "q", Types: KindQueryValue.Types()},
+			},
+		},
+		{
+			name:   "required port",
+			format: "http://example.com:{!}/",
+			want: []Placeholder{
+				{Index: 0, Name: "port", Kind: KindPort, Types: KindPort.Types(), Required: true},
+			},
+		},
+		{
+			name:   "port with default",
+			format: "http://example.com:{=8080}/",
+			want: []Placeholder{
+				{Index: 0, Name: "port", Kind: KindPort, Types: KindPort.Types(), Default: ptr("8080")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Compile(tt.format)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, tmpl.Placeholders())
+		})
+	}
+}
+
+func TestTemplateStaticParts(t *testing.T) {
+	tmpl := MustCompile("https://api.example.com:8443/api/v1/users/{}?page={}")
+	assert.Equal(t, "https://api.example.com:8443/api/v1/users/{}?page={}", tmpl.String())
+	assert.Equal(t, "https", tmpl.Scheme())
+	assert.Equal(t, "api.example.com", tmpl.Host())
+	assert.Equal(t, uint16(8443), tmpl.Port())
+	assert.Equal(t, "/api/v1/users/", tmpl.PathPrefix())
+
+	tmpl = MustCompile("{}://{}/{}")
+	assert.Equal(t, "", tmpl.Scheme())
+	assert.Equal(t, "", tmpl.Host())
+	assert.Equal(t, uint16(0), tmpl.Port())
+	assert.Equal(t, "/", tmpl.PathPrefix())
+
+	_, err := Compile("https://example.com:port/")
+	assert.IsError(t, err, ErrParseFailed)
+}
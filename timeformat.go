@@ -0,0 +1,82 @@
+package urlf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Time formats for Opt.TimeFormat and format specs of placeholders like {:unixms}.
+// Other values are used as layouts of time.Time.Format like "2006-01-02T15:04".
+const (
+	TimeRFC3339     = "rfc3339" // default
+	TimeRFC3339Nano = "rfc3339nano"
+	TimeUnix        = "unix"   // seconds
+	TimeUnixMilli   = "unixms" // milliseconds
+	TimeDate        = "date"   // 2006-01-02
+)
+
+// checkTimeFormat returns an error if the format is neither a name of the time formats nor a layout.
+func checkTimeFormat(format string) error {
+	switch format {
+	case "", TimeRFC3339, TimeRFC3339Nano, TimeUnix, TimeUnixMilli, TimeDate:
+		return nil
+	}
+	for _, e := range layoutElements {
+		if strings.Contains(format, e) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown time format '%s'", format)
+}
+
+// layoutElements are elements of the reference time that layouts must have. Single character elements like "1" or "5"
+// are not included to reject typos of printf style specs like "x2".
+var layoutElements = []string{"2006", "06", "01", "02", "_2", "15", "03", "04", "05", "Jan", "Mon", "MST", "PM", "pm", "Z07", "-07", ".000", ".999", ",000", ",999"}
+
+// appendTime appends the time in the format of the placeholder or Opt.TimeFormat.
+func (st *formatState) appendTime(dst []byte, t time.Time, format string) ([]byte, error) {
+	if format == "" {
+		format = st.f.timeFormat
+	}
+	if err := checkTimeFormat(format); err != nil {
+		return dst, err
+	}
+	t = t.In(st.f.timeLocation)
+	switch format {
+	case "", TimeRFC3339:
+		return t.AppendFormat(dst, time.RFC3339), nil
+	case TimeRFC3339Nano:
+		return t.AppendFormat(dst, time.RFC3339Nano), nil
+	case TimeUnix:
+		return strconv.AppendInt(dst, t.Unix(), 10), nil
+	case TimeUnixMilli:
+		return strconv.AppendInt(dst, t.UnixMilli(), 10), nil
+	case TimeDate:
+		return t.AppendFormat(dst, time.DateOnly), nil
+	}
+	return t.AppendFormat(dst, format), nil
+}
+
+// appendDuration appends the duration as seconds or milliseconds for the unix formats, otherwise like "1h30m0s".
+// Format specs of placeholders other than the unix formats are errors because they are only for time values.
+func (st *formatState) appendDuration(dst []byte, d time.Duration, format string) ([]byte, error) {
+	switch format {
+	case "":
+		format = st.f.timeFormat
+	case TimeUnix, TimeUnixMilli:
+	default:
+		return dst, fmt.Errorf("format spec ':%s' is not available for durations", format)
+	}
+	if err := checkTimeFormat(format); err != nil {
+		return dst, err
+	}
+	switch format {
+	case TimeUnix:
+		return strconv.AppendInt(dst, int64(d/time.Second), 10), nil
+	case TimeUnixMilli:
+		return strconv.AppendInt(dst, d.Milliseconds(), 10), nil
+	}
+	return append(dst, d.String()...), nil
+}
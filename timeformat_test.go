@@ -0,0 +1,47 @@
+package urlf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestFormatTime(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	at := time.Date(2024, 1, 2, 9, 4, 5, 600_000_000, jst) // 2024-01-02T00:04:05.6Z
+	var nilTime *time.Time
+	tests := []formatCase{
+		{name: "default", format: "https://example.com/?at={}", args: []any{at}, want: "https://example.com/?at=2024-01-02T00%3A04%3A05Z"},
+		{name: "pointer", format: "https://example.com/{}", args: []any{&at}, want: "https://example.com/2024-01-02T00:04:05Z"},
+		{name: "nil pointer", format: "https://example.com/?at={}", args: []any{nilTime}, want: "https://example.com/"},
+		{name: "unix", opt: Opt{TimeFormat: TimeUnix}, format: "https://example.com/?at={}", args: []any{at}, want: "https://example.com/?at=1704153845"},
+		{name: "unixms spec", opt: Opt{TimeFormat: TimeUnix}, format: "https://example.com/?at={:unixms}", args: []any{at}, want: "https://example.com/?at=1704153845600"},
+		{name: "date", format: "https://example.com/reports/{:date}", args: []any{at}, want: "https://example.com/reports/2024-01-02"},
+		{name: "rfc3339nano", format: "https://example.com/#{:rfc3339nano}", args: []any{at}, want: "https://example.com/#2024-01-02T00:04:05.6Z"},
+		{name: "layout", format: "https://example.com/?at={:2006-01-02T15:04}", args: []any{at}, want: "https://example.com/?at=2024-01-02T00%3A04"},
+		{name: "digit-free layout", format: "https://example.com/{:Mon}/{:Jan}", args: []any{at, at}, want: "https://example.com/Tue/Jan"},
+		{name: "compact date", format: "https://example.com/{:20060102}", args: []any{at}, want: "https://example.com/20240102"},
+		{name: "location", opt: Opt{TimeLocation: jst}, format: "https://example.com/?at={}", args: []any{at}, want: "https://example.com/?at=2024-01-02T09%3A04%3A05%2B09%3A00"},
+		{name: "slice", format: "https://example.com/?d={:date}", args: []any{[]time.Time{at, at.AddDate(0, 0, 1)}}, want: "https://example.com/?d=2024-01-02&d=2024-01-03"},
+		{name: "query key", format: "https://example.com/?{:unix}=1", args: []any{at}, want: "https://example.com/?1704153845=1"},
+		{name: "duration", format: "https://example.com/?ttl={}", args: []any{90 * time.Minute}, want: "https://example.com/?ttl=1h30m0s"},
+		{name: "duration unix", format: "https://example.com/?ttl={:unix}&timeout={:unixms}", args: []any{90 * time.Minute, 1500 * time.Millisecond}, want: "https://example.com/?timeout=1500&ttl=5400"},
+	}
+	testFormat(t, tests)
+}
+
+func TestFormatTimeError(t *testing.T) {
+	_, err := TryCustomFormatter(Opt{TimeFormat: "millis"})("https://example.com/")
+	assert.IsError(t, err, ErrParseFailed)
+	_, err = TryUrlf("https://example.com/{:millis}", time.Now())
+	assert.IsError(t, err, ErrParseFailed)
+
+	tests := []formatErrorCase{
+		{name: "not a time", format: "https://example.com/?id={:unix}", args: []any{10}, wantMsg: "format spec ':unix' is available only for time values"},
+		{name: "layout for duration", format: "https://example.com/a/{:2006-01-02}", args: []any{90 * time.Second}, wantMsg: "format spec ':2006-01-02' is not available for durations"},
+		{name: "date for duration", format: "https://example.com/?ttl={:date}", args: []any{90 * time.Second}, wantMsg: "format spec ':date' is not available for durations"},
+		{name: "rfc3339 for duration", format: "https://example.com/?ttl={:rfc3339}", args: []any{90 * time.Second}, wantMsg: "format spec ':rfc3339' is not available for durations"},
+	}
+	testFormatError(t, tests)
+}
@@ -0,0 +1,358 @@
+package urlf
+
+import (
+	stdencoding "encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+)
+
+var errUnsupported = errors.New("unsupported type")
+
+// appendValue appends the text of a scalar value to dst with the format spec of the placeholder.
+// It returns false if the value is nil or a nil pointer.
+//
+// Encoders are used for the types other than strings, bools and numbers.
+func (st *formatState) appendValue(dst []byte, v any, spec *formatSpec) ([]byte, bool, error) {
+	var format string // time format
+	if spec == nil {
+		if d, ok, isBasic := st.appendBasic(dst, v); isBasic {
+			return d, ok, nil
+		}
+	}
+	if nv, ok := st.nullValue(v); ok {
+		return st.appendValue(dst, nv, spec)
+	}
+	if spec != nil {
+		if spec.kind != specTime {
+			return st.appendSpec(dst, v, spec)
+		}
+		format = spec.text
+	}
+	if e, ok := st.encoder(v); ok {
+		return e.appendValue(dst, v)
+	}
+	switch v := v.(type) {
+	case time.Time:
+		dst, err := st.appendTime(dst, v, format)
+		return dst, err == nil, err
+	case *time.Time:
+		if v == nil {
+			return dst, false, nil
+		}
+		dst, err := st.appendTime(dst, *v, format)
+		return dst, err == nil, err
+	case time.Duration:
+		dst, err := st.appendDuration(dst, v, format)
+		return dst, err == nil, err
+	case *time.Duration:
+		if v == nil {
+			return dst, false, nil
+		}
+		dst, err := st.appendDuration(dst, *v, format)
+		return dst, err == nil, err
+	}
+	if spec != nil {
+		return dst, false, fmt.Errorf("format spec ':%s' is available only for time values", format)
+	}
+	return st.appendOther(dst, v)
+}
+
+// appendBasic appends strings, bools and numbers. isBasic is false for the other types.
+func (st *formatState) appendBasic(dst []byte, v any) (_ []byte, ok, isBasic bool) {
+	if d, ok, isInt := appendInt(dst, v); isInt {
+		return d, ok, true
+	}
+	switch v := v.(type) {
+	case string:
+		return append(dst, v...), true, true
+	case *string:
+		if v == nil {
+			return dst, false, true
+		}
+		return append(dst, *v...), true, true
+	case bool:
+		return strconv.AppendBool(dst, v), true, true
+	case *bool:
+		if v == nil {
+			return dst, false, true
+		}
+		return strconv.AppendBool(dst, *v), true, true
+	case float64:
+		return strconv.AppendFloat(dst, v, st.f.floatFormat, st.f.floatPrec, 64), true, true
+	case *float64:
+		if v == nil {
+			return dst, false, true
+		}
+		return strconv.AppendFloat(dst, *v, st.f.floatFormat, st.f.floatPrec, 64), true, true
+	case float32:
+		return strconv.AppendFloat(dst, float64(v), st.f.floatFormat, st.f.floatPrec, 32), true, true
+	case *float32:
+		if v == nil {
+			return dst, false, true
+		}
+		return strconv.AppendFloat(dst, float64(*v), st.f.floatFormat, st.f.floatPrec, 32), true, true
+	case *big.Float:
+		if v == nil {
+			return dst, false, true
+		}
+		return v.Append(dst, st.f.floatFormat, st.f.floatPrec), true, true
+	case nil:
+		return dst, false, true
+	}
+	return dst, false, false
+}
+
+// appendOther appends values that implement encoding.TextMarshaler or fmt.Stringer in this order,
+// and values of named types like "type UserID int64" by their underlying kinds.
+func (st *formatState) appendOther(dst []byte, v any) ([]byte, bool, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return dst, false, nil
+		}
+	}
+	switch v := v.(type) {
+	case stdencoding.TextMarshaler:
+		text, err := v.MarshalText()
+		if err != nil {
+			return dst, false, fmt.Errorf("MarshalText failed: %w", err)
+		}
+		return append(dst, text...), true, nil
+	case fmt.Stringer:
+		return append(dst, v.String()...), true, nil
+	}
+	rv = reflect.Indirect(rv)
+	switch rv.Kind() {
+	case reflect.String:
+		return append(dst, rv.String()...), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(dst, rv.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.AppendUint(dst, rv.Uint(), 10), true, nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.AppendFloat(dst, rv.Float(), st.f.floatFormat, st.f.floatPrec, rv.Type().Bits()), true, nil
+	case reflect.Bool:
+		return strconv.AppendBool(dst, rv.Bool()), true, nil
+	}
+	return dst, false, errUnsupported
+}
+
+// nullValue unwraps nullable types like sql.NullString, sql.Null[T] and Optional[T] of your own:
+// structs with a bool field "Valid" and an exported field of the value. It returns nil if Valid is false.
+// This is a structural heuristic, so ok is false for the types that have encoders,
+// encoding.TextMarshaler or fmt.Stringer because they define their own text.
+func (st *formatState) nullValue(v any) (_ any, ok bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct || rv.NumField() != 2 {
+		return v, false
+	}
+	if _, ok := st.encoder(v); ok || hasText(v) {
+		return v, false
+	}
+	t := rv.Type()
+	valid := 0
+	if t.Field(0).Name != "Valid" {
+		valid = 1
+	}
+	if f := t.Field(valid); f.Name != "Valid" || f.Type.Kind() != reflect.Bool || !t.Field(1-valid).IsExported() {
+		return v, false
+	}
+	if !rv.Field(valid).Bool() {
+		return nil, true
+	}
+	return rv.Field(1 - valid).Interface(), true
+}
+
+// isEmpty reports whether the value is a zero value or an empty slice, map or string for Opt.OmitEmpty.
+func isEmpty(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
+
+// textValue returns a textual value for protocol, hostname and userinfo:
+// strings, encoding.TextMarshaler, fmt.Stringer and named string types.
+func textValue(v any) (string, bool, error) {
+	switch v := v.(type) {
+	case string:
+		return v, true, nil
+	case *string:
+		if v == nil {
+			return "", false, nil
+		}
+		return *v, true, nil
+	case nil:
+		return "", false, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return "", false, nil
+	}
+	switch v := v.(type) {
+	case stdencoding.TextMarshaler:
+		text, err := v.MarshalText()
+		if err != nil {
+			return "", false, fmt.Errorf("MarshalText failed: %w", err)
+		}
+		return string(text), true, nil
+	case fmt.Stringer:
+		return v.String(), true, nil
+	}
+	if rv = reflect.Indirect(rv); rv.Kind() == reflect.String {
+		return rv.String(), true, nil
+	}
+	return "", false, errors.New("only string is available")
+}
+
+// hasText reports whether the value implements encoding.TextMarshaler or fmt.Stringer.
+// Such slices like net.IP are single values and named integers like enums are text.
+func hasText(v any) bool {
+	switch v.(type) {
+	case stdencoding.TextMarshaler, fmt.Stringer:
+		return true
+	}
+	return false
+}
+
+// appendInt appends the text of an integer value to dst.
+// isInt is false if v is not an integer type, and ok is false if v is a nil pointer.
+func appendInt(dst []byte, v any) (_ []byte, ok, isInt bool) {
+	switch v := v.(type) {
+	case int:
+		return strconv.AppendInt(dst, int64(v), 10), true, true
+	case int8:
+		return strconv.AppendInt(dst, int64(v), 10), true, true
+	case int16:
+		return strconv.AppendInt(dst, int64(v), 10), true, true
+	case int32:
+		return strconv.AppendInt(dst, int64(v), 10), true, true
+	case int64:
+		return strconv.AppendInt(dst, v, 10), true, true
+	case uint:
+		return strconv.AppendUint(dst, uint64(v), 10), true, true
+	case uint8:
+		return strconv.AppendUint(dst, uint64(v), 10), true, true
+	case uint16:
+		return strconv.AppendUint(dst, uint64(v), 10), true, true
+	case uint32:
+		return strconv.AppendUint(dst, uint64(v), 10), true, true
+	case uint64:
+		return strconv.AppendUint(dst, v, 10), true, true
+	case *int:
+		if v != nil {
+			return strconv.AppendInt(dst, int64(*v), 10), true, true
+		}
+	case *int8:
+		if v != nil {
+			return strconv.AppendInt(dst, int64(*v), 10), true, true
+		}
+	case *int16:
+		if v != nil {
+			return strconv.AppendInt(dst, int64(*v), 10), true, true
+		}
+	case *int32:
+		if v != nil {
+			return strconv.AppendInt(dst, int64(*v), 10), true, true
+		}
+	case *int64:
+		if v != nil {
+			return strconv.AppendInt(dst, *v, 10), true, true
+		}
+	case *uint:
+		if v != nil {
+			return strconv.AppendUint(dst, uint64(*v), 10), true, true
+		}
+	case *uint8:
+		if v != nil {
+			return strconv.AppendUint(dst, uint64(*v), 10), true, true
+		}
+	case *uint16:
+		if v != nil {
+			return strconv.AppendUint(dst, uint64(*v), 10), true, true
+		}
+	case *uint32:
+		if v != nil {
+			return strconv.AppendUint(dst, uint64(*v), 10), true, true
+		}
+	case *uint64:
+		if v != nil {
+			return strconv.AppendUint(dst, *v, 10), true, true
+		}
+	case json.Number:
+		return append(dst, v...), true, true
+	case *big.Int:
+		if v != nil {
+			return v.Append(dst, 10), true, true
+		}
+	default:
+		return dst, false, false
+	}
+	return dst, false, true // nil pointer
+}
+
+// appendPort appends the port number. It accepts only integers between 0 and 65535.
+func appendPort(dst []byte, v any) ([]byte, bool, error) {
+	start := len(dst)
+	dst, ok, isInt := appendInt(dst, v)
+	if !isInt {
+		// named integer types like "type Port uint16"
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+			rv = rv.Elem()
+		}
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			dst, ok, isInt = strconv.AppendInt(dst, rv.Int(), 10), true, true
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			dst, ok, isInt = strconv.AppendUint(dst, rv.Uint(), 10), true, true
+		}
+	}
+	if v == nil || !ok && isInt {
+		return dst, false, nil
+	}
+	if !isInt {
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return dst, false, nil
+		}
+		return dst[:start], false, errors.New("only integer is available")
+	}
+	port := dst[start:]
+	n := 0
+	for _, c := range port {
+		if c < '0' || '9' < c || n > 65535 {
+			n = -1
+			break
+		}
+		n = n*10 + int(c-'0')
+	}
+	if len(port) == 0 || n < 0 || n > 65535 {
+		return dst[:start], false, errors.New("port must be between 0 and 65535")
+	}
+	return dst, true, nil
+}
+
+var (
+	stringTypes  = []string{"string", "*string"}
+	integerTypes = []string{
+		"int", "*int", "int8", "*int8", "int16", "*int16", "int32", "*int32", "int64", "*int64",
+		"uint", "*uint", "uint8", "*uint8", "uint16", "*uint16", "uint32", "*uint32", "uint64", "*uint64",
+		"json.Number", "*big.Int",
+	}
+	textTypes   = slices.Concat(stringTypes, []string{"encoding.TextMarshaler", "fmt.Stringer"})
+	scalarTypes = slices.Concat(textTypes, integerTypes, []string{"float32", "*float32", "float64", "*float64", "*big.Float", "bool", "*bool", "time.Time", "*time.Time", "time.Duration", "*time.Duration", "sql.Null[T]"})
+)
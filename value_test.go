@@ -0,0 +1,184 @@
+package urlf
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestFormatValues(t *testing.T) {
+	id := int64(1 << 40)
+	port := uint16(8080)
+	lat := 35.6812
+	flag := true
+	var nilInt64 *int64
+	tests := []formatCase{
+		{name: "int64", format: "https://example.com/users/{}?id={}", args: []any{id, &id}, want: "https://example.com/users/1099511627776?id=1099511627776"},
+		{name: "small integers", format: "https://example.com/{}/{}/{}?a={}&b={}", args: []any{int8(-8), int16(16), int32(32), uint8(8), uint(1)}, want: "https://example.com/-8/16/32?a=8&b=1"},
+		{name: "uint64", format: "https://example.com/{}", args: []any{uint64(18446744073709551615)}, want: "https://example.com/18446744073709551615"},
+		{name: "port", format: "https://example.com:{}/", args: []any{&port}, want: "https://example.com:8080/"},
+		{name: "port uint32", format: "https://example.com:{}/", args: []any{uint32(443)}, want: "https://example.com:443/"},
+		{name: "nil pointer", format: "https://example.com:{}/{}?a={}", args: []any{nilInt64, nilInt64, nilInt64}, want: "https://example.com/"},
+		{name: "float", format: "https://example.com/map?lat={}&lng={}", args: []any{&lat, float32(139.7671)}, want: "https://example.com/map?lat=35.6812&lng=139.7671"},
+		{name: "float precision", opt: Opt{FloatPrecision: ptr(2)}, format: "https://example.com/map?lat={}", args: []any{lat}, want: "https://example.com/map?lat=35.68"},
+		{name: "float precision 0", opt: Opt{FloatPrecision: ptr(0)}, format: "https://example.com/map?lat={}", args: []any{lat}, want: "https://example.com/map?lat=36"},
+		{name: "float format", opt: Opt{FloatFormat: 'e'}, format: "https://example.com/?v={}", args: []any{1500.0}, want: "https://example.com/?v=1.5e%2B03"},
+		{name: "bool", format: "https://example.com/{}?active={}", args: []any{false, &flag}, want: "https://example.com/false?active=true"},
+		{name: "json.Number", format: "https://example.com:{}/{}?price={}", args: []any{json.Number("8080"), json.Number("42"), json.Number("1.5")}, want: "https://example.com:8080/42?price=1.5"},
+		{name: "big", format: "https://example.com/{}?v={}", args: []any{new(big.Int).Lsh(big.NewInt(1), 70), big.NewFloat(0.25)}, want: "https://example.com/1180591620717411303424?v=0.25"},
+		{name: "fragment", format: "https://example.com/#{}", args: []any{12}, want: "https://example.com/#12"},
+		{name: "query key", format: "https://example.com/?{}={}", args: []any{uint(1), true}, want: "https://example.com/?1=true"},
+		{name: "slices", format: "https://example.com/{}?id={}", args: []any{[]int64{1, 2}, []any{uint8(3), 4.5, nil, true}}, want: "https://example.com/1/2?id=3&id=4.5&id=true"},
+	}
+	testFormat(t, tests)
+}
+
+func TestFormatValuesError(t *testing.T) {
+	type custom struct{}
+	tests := []struct {
+		name     string
+		format   string
+		args     []any
+		wantPart string
+		wantMsg  string
+	}{
+		{name: "path", format: "https://example.com/{}", args: []any{custom{}}, wantPart: "path", wantMsg: "unsupported type"},
+		{name: "path slice", format: "https://example.com/{}", args: []any{[]any{"a", custom{}}}, wantPart: "path", wantMsg: "element 1: unsupported type"},
+		{name: "typed path slice", format: "https://example.com/{}", args: []any{[]custom{{}}}, wantPart: "path", wantMsg: "element 0: unsupported type"},
+		{name: "nested slice", format: "https://example.com/{}", args: []any{[]any{[]string{"a"}}}, wantPart: "path", wantMsg: "element 0: unsupported type"},
+		{name: "query", format: "https://example.com/?a={}", args: []any{map[string]string{}}, wantPart: "query", wantMsg: "unsupported type"},
+		{name: "query slice", format: "https://example.com/?a={}", args: []any{[]any{1, custom{}}}, wantPart: "query", wantMsg: "element 1: unsupported type"},
+		{name: "query key", format: "https://example.com/?{}=1", args: []any{custom{}}, wantPart: "query", wantMsg: "query key of '{}': unsupported type"},
+		{name: "fragment", format: "https://example.com/#{}", args: []any{custom{}}, wantPart: "fragment", wantMsg: "unsupported type"},
+		{name: "port string", format: "https://example.com:{}/", args: []any{"8080"}, wantPart: "port", wantMsg: "only integer is available"},
+		{name: "port float", format: "https://example.com:{}/", args: []any{80.0}, wantPart: "port", wantMsg: "only integer is available"},
+		{name: "port range", format: "https://example.com:{}/", args: []any{70000}, wantPart: "port", wantMsg: "port must be between 0 and 65535"},
+		{name: "negative port", format: "https://example.com:{}/", args: []any{int8(-1)}, wantPart: "port", wantMsg: "port must be between 0 and 65535"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := TryUrlf(tt.format, tt.args...)
+			assert.IsError(t, err, ErrFormatFailed)
+			var fe *FormatError
+			assert.True(t, errors.As(err, &fe))
+			assert.Equal(t, tt.wantPart, fe.Part)
+			assert.Equal(t, tt.wantMsg, fe.Reason)
+		})
+	}
+}
+
+type userID int64
+
+type status string
+
+type color int
+
+func (c color) String() string {
+	return [...]string{"red", "green"}[c]
+}
+
+type ulid [2]byte
+
+func (u ulid) MarshalText() ([]byte, error) {
+	if u == (ulid{}) {
+		return nil, errors.New("empty ulid")
+	}
+	return []byte(fmt.Sprintf("%02X%02X", u[0], u[1])), nil
+}
+
+// String is ignored because MarshalText has priority.
+func (u ulid) String() string {
+	return "ulid"
+}
+
+type portNumber uint16
+
+func TestFormatTextValues(t *testing.T) {
+	id := userID(1000)
+	var nilID *userID
+	var nilULID *ulid
+	tests := []formatCase{
+		{name: "named int", format: "https://example.com/users/{}?id={}", args: []any{id, &id}, want: "https://example.com/users/1000?id=1000"},
+		{name: "named string", format: "https://example.com/?status={}#{}", args: []any{status("open"), status("top")}, want: "https://example.com/?status=open#top"},
+		{name: "stringer", format: "https://example.com/colors/{}?{}=1", args: []any{color(1), color(0)}, want: "https://example.com/colors/green?red=1"},
+		{name: "text marshaler", format: "https://example.com/items/{}", args: []any{ulid{0xAB, 0x01}}, want: "https://example.com/items/AB01"},
+		{name: "net.IP is not a slice", format: "http://example.com/hosts/{}?ip={}", args: []any{net.IPv4(10, 0, 0, 1), net.ParseIP("::1")}, want: "http://example.com/hosts/10.0.0.1?ip=%3A%3A1"},
+		{name: "slices", format: "https://example.com/{}?s={}", args: []any{[]userID{1, 2}, []any{status("a"), color(0)}}, want: "https://example.com/1/2?s=a&s=red"},
+		{name: "nil pointers", format: "https://example.com/{}?id={}&u={}", args: []any{nilID, nilID, nilULID}, want: "https://example.com/"},
+		{name: "hostname and userinfo", format: "{}://{}@{}:{}/", args: []any{status("https"), status("user"), status("example.com"), portNumber(8443)}, want: "https://user@example.com:8443/"},
+	}
+	testFormat(t, tests)
+}
+
+func TestFormatTextValuesError(t *testing.T) {
+	_, err := TryUrlf("https://example.com/items/{}", ulid{})
+	var fe *FormatError
+	assert.True(t, errors.As(err, &fe))
+	assert.Equal(t, "MarshalText failed: empty ulid", fe.Reason)
+
+	_, err = TryUrlf("https://{}/", 10)
+	assert.True(t, errors.As(err, &fe))
+	assert.Equal(t, "hostname", fe.Part)
+	assert.Equal(t, "only string is available", fe.Reason)
+}
+
+type optional[T any] struct {
+	Value T
+	Valid bool
+}
+
+// validatedName has the shape of nullable types, but it formats itself by String.
+type validatedName struct {
+	Valid bool
+	Name  string
+}
+
+func (n validatedName) String() string {
+	return "name-" + n.Name
+}
+
+func TestFormatNullValues(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []formatCase{
+		{name: "null string", format: "https://example.com/?q={}", args: []any{sql.NullString{String: "go", Valid: true}}, want: "https://example.com/?q=go"},
+		{name: "invalid null string", format: "https://example.com/?q={}", args: []any{sql.NullString{String: "go"}}, want: "https://example.com/"},
+		{name: "null int64 in path", format: "https://example.com/users/{}", args: []any{sql.NullInt64{Int64: 10, Valid: true}}, want: "https://example.com/users/10"},
+		{name: "null time", format: "https://example.com/?at={:date}", args: []any{sql.NullTime{Time: at, Valid: true}}, want: "https://example.com/?at=2024-01-02"},
+		{name: "generic null", format: "https://example.com/?id={:05d}", args: []any{sql.Null[int]{V: 42, Valid: true}}, want: "https://example.com/?id=00042"},
+		{name: "pointer", format: "https://example.com/?q={}", args: []any{&sql.NullString{String: "go", Valid: true}}, want: "https://example.com/?q=go"},
+		{name: "own optional", format: "https://example.com/?page={}&per={}", args: []any{optional[int]{Value: 2, Valid: true}, optional[int]{}}, want: "https://example.com/?page=2"},
+		{name: "slice", format: "https://example.com/?id={}", args: []any{[]sql.NullInt64{{Int64: 1, Valid: true}, {}, {Int64: 3, Valid: true}}}, want: "https://example.com/?id=1&id=3"},
+		{name: "host", format: "https://{}/api", args: []any{sql.NullString{String: "example.com", Valid: true}}, want: "https://example.com/api"},
+		{name: "default", format: "https://example.com/?page={=1}", args: []any{sql.NullInt32{}}, want: "https://example.com/?page=1"},
+		{name: "stringer", format: "https://example.com/?n={}", args: []any{validatedName{Valid: true, Name: "go"}}, want: "https://example.com/?n=name-go"},
+	}
+	testFormat(t, tests)
+
+	_, err := TryUrlf("https://example.com/users/{!}", sql.NullInt64{})
+	assert.IsError(t, err, ErrFormatFailed)
+}
+
+func TestOmitEmpty(t *testing.T) {
+	zero := 0
+	tests := []formatCase{
+		{name: "keep zero values", format: "https://example.com/?word={}&page={}", args: []any{"", 0}, want: "https://example.com/?page=0&word="},
+		{name: "omit zero values", opt: Opt{OmitEmpty: true}, format: "https://example.com/?word={}&page={}&all={}", args: []any{"", 0, false}, want: "https://example.com/"},
+		{name: "omit empty slice", opt: Opt{OmitEmpty: true}, format: "https://example.com/?id={}", args: []any{[]int{}}, want: "https://example.com/"},
+		{name: "pointer to zero", opt: Opt{OmitEmpty: true}, format: "https://example.com/?page={}", args: []any{&zero}, want: "https://example.com/?page=0"},
+		{name: "path", opt: Opt{OmitEmpty: true}, format: "https://example.com/users/{}", args: []any{""}, want: "https://example.com/users/"},
+		{name: "host", opt: Opt{OmitEmpty: true}, format: "https://{}/api", args: []any{""}, want: "/api"},
+		{name: "default", opt: Opt{OmitEmpty: true}, format: "https://example.com/?page={=1}", args: []any{0}, want: "https://example.com/?page=1"},
+		{name: "zero time", opt: Opt{OmitEmpty: true}, format: "https://example.com/?since={}", args: []any{time.Time{}}, want: "https://example.com/"},
+	}
+	testFormat(t, tests)
+
+	_, err := TryCustomFormatter(Opt{OmitEmpty: true})("https://example.com/users/{!}", 0)
+	assert.IsError(t, err, ErrFormatFailed)
+}